@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// readCommandAliases reads the YAML or JSON file defining command aliases,
+// each one being a command line run by the shell, or a command vector, e.g.
+// {ping: "redis-cli ping", ready: [pg_isready, -q]}.
+func readCommandAliases(path string) (map[string][]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read command aliases file: %w", err)
+	}
+	var file map[string]interface{}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("Invalid command aliases file: %w", err)
+	}
+
+	aliases := map[string][]string{}
+	for name, value := range file {
+		switch value := value.(type) {
+		case string:
+			aliases[name] = []string{"/bin/sh", "-c", value}
+		case []interface{}:
+			for _, word := range value {
+				s, ok := word.(string)
+				if !ok {
+					return nil, fmt.Errorf(`Invalid command of alias "%v", arguments must be strings`, name)
+				}
+				aliases[name] = append(aliases[name], s)
+			}
+		}
+		if len(aliases[name]) == 0 {
+			return nil, fmt.Errorf(`Invalid command of alias "%v" [Format: 'command line' or '[command, arg, ...]']`, name)
+		}
+	}
+	return aliases, nil
+}
+
+// resolveCommandAlias returns the command vector of the alias, defined by a
+// --command-alias flag, which takes precedence, or else in the aliases file.
+func resolveCommandAlias(req *Request) ([]string, error) {
+	for _, alias := range req.CommandAliases {
+		kv := strings.SplitN(alias, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || strings.TrimSpace(kv[1]) == "" {
+			return nil, fmt.Errorf(`Invalid command alias "%v" [Format: 'name=command line']`, alias)
+		}
+		if kv[0] == req.RunAlias {
+			return []string{"/bin/sh", "-c", kv[1]}, nil
+		}
+	}
+	if req.AliasesFile != "" {
+		aliases, err := readCommandAliases(req.AliasesFile)
+		if err != nil {
+			return nil, err
+		}
+		if command, ok := aliases[req.RunAlias]; ok {
+			return command, nil
+		}
+	}
+	return nil, fmt.Errorf(`Unknown command alias "%v"`, req.RunAlias)
+}
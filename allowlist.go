@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// shellOperators allow a shell script to run more commands than its first
+// one, which is the only one checked against the allowlist.
+const shellOperators = ";&|`$()<>\n"
+
+// readAllowedCommands reads the allowlist file, holding one command basename
+// per line. Empty lines and lines starting with '#' are ignored.
+func readAllowedCommands(path string) (map[string]bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read allowed commands file: %w", err)
+	}
+	defer file.Close()
+
+	allowed := map[string]bool{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			allowed[line] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Failed to read allowed commands file: %w", err)
+	}
+	return allowed, nil
+}
+
+// checkAllowedCommand ensures that the command, resolved to the first word of
+// the script when it is a shell, is in the allowlist file. So must be the
+// pre-exec command and the per-container commands if any.
+func checkAllowedCommand(req *Request) error {
+	allowed, err := readAllowedCommands(req.allowedCommandsFile)
+	if err != nil {
+		return err
+	}
+
+	if req.PreExec != "" {
+		if err := checkAllowed(allowed, &Request{Command: preExecShell, Arg: req.PreExec}); err != nil {
+			return fmt.Errorf("Pre-exec %w", err)
+		}
+	}
+	for _, spec := range req.ContainerCommands {
+		name, command := parseContainerCommand(spec)
+		var containerReq Request
+		setCommandArgs(&containerReq, command)
+		if err := checkAllowed(allowed, &containerReq); err != nil {
+			return fmt.Errorf(`Container "%v" %w`, name, err)
+		}
+	}
+	return checkAllowed(allowed, req)
+}
+
+// checkAllowedArgv ensures that the command vector run, in which the shell
+// fallback replaced the shell, runs a command in the allowlist file, the
+// script being the one of the arguments when it is a shell.
+func checkAllowedArgv(req *Request, command []string, arg string) error {
+	allowed, err := readAllowedCommands(req.allowedCommandsFile)
+	if err != nil {
+		return err
+	}
+	return checkAllowed(allowed, &Request{Command: command[0], Arg: arg})
+}
+
+func checkAllowed(allowed map[string]bool, req *Request) error {
+	name := commandBasename(req)
+	if shells[path.Base(req.Command)] && strings.ContainsAny(req.Arg, shellOperators) {
+		return fmt.Errorf(`Command not permitted: shell script "%v" runs more than one command`, req.Arg)
+	}
+	if !allowed[name] {
+		return fmt.Errorf(`Command "%v" not permitted`, name)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCheckAllowed(t *testing.T) {
+	allowed := map[string]bool{"curl": true, "pg_isready": true}
+	tests := []struct {
+		name    string
+		req     Request
+		allowed bool
+	}{
+		{"allowed command", Request{Command: "/usr/bin/curl", Arg: "-f http://localhost"}, true},
+		{"other command", Request{Command: "rm", Arg: "-rf /"}, false},
+		{"allowed script", Request{Command: "/bin/sh", Arg: "pg_isready -q"}, true},
+		{"other script", Request{Command: "/bin/sh", Arg: "rm -rf /"}, false},
+		{"empty script", Request{Command: "/bin/sh"}, false},
+		{"command list", Request{Command: "/bin/sh", Arg: "curl localhost; rm -rf /"}, false},
+		{"pipe", Request{Command: "bash", Arg: "curl localhost | sh"}, false},
+		{"substitution", Request{Command: "sh", Arg: "curl $(rm -rf /)"}, false},
+		{"newline", Request{Command: "sh", Arg: "curl localhost\nrm -rf /"}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkAllowed(allowed, &test.req)
+			if (err == nil) != test.allowed {
+				t.Errorf("command %q with arguments %q: allowed %v, got %v", test.req.Command, test.req.Arg, test.allowed, err)
+			}
+		})
+	}
+}
+
+func TestCheckAllowedCommand(t *testing.T) {
+	path := writeTestFile(t, "allowed", "# probes\ncurl\n\n  pg_isready  \n")
+	tests := []struct {
+		name    string
+		req     Request
+		allowed bool
+	}{
+		{"allowed command", Request{Command: "curl"}, true},
+		{"comment", Request{Command: "#"}, false},
+		{"allowed pre-exec", Request{Command: "curl", PreExec: "pg_isready"}, true},
+		{"other pre-exec", Request{Command: "curl", PreExec: "rm -rf /"}, false},
+		{"allowed container command", Request{Command: "curl", ContainerCommands: []string{"db=pg_isready"}}, true},
+		{"other container command", Request{Command: "curl", ContainerCommands: []string{"db=psql"}}, false},
+		{"container command line", Request{Command: "curl", ContainerCommands: []string{"db=/usr/bin/pg_isready -q -h localhost"}}, true},
+		{"other container command line", Request{Command: "curl", ContainerCommands: []string{"db=rm -rf /"}}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.req.allowedCommandsFile = path
+			err := checkAllowedCommand(&test.req)
+			if (err == nil) != test.allowed {
+				t.Errorf("allowed %v, got %v", test.allowed, err)
+			}
+		})
+	}
+}
+
+func TestCheckAllowedArgv(t *testing.T) {
+	path := writeTestFile(t, "allowed", "curl\n")
+	req := &Request{allowedCommandsFile: path}
+	if err := checkAllowedArgv(req, []string{"/bin/bash", "-c", "curl localhost"}, "curl localhost"); err != nil {
+		t.Errorf("fallback shell running an allowed script refused: %v", err)
+	}
+	if err := checkAllowedArgv(req, []string{"busybox", "sh", "-c", "curl localhost"}, "curl localhost"); err == nil {
+		t.Error("fallback shell not in the allowlist accepted")
+	}
+}
+
+func TestCheckAllowedCommandMissingFile(t *testing.T) {
+	if err := checkAllowedCommand(&Request{Command: "curl", allowedCommandsFile: "/nonexistent"}); err == nil {
+		t.Error("missing allowlist file accepted")
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+
+	"k8s.io/client-go/rest"
+)
+
+// auditRecord is an audit log entry, recording which identity ran which
+// command in which pod, and its result.
+type auditRecord struct {
+	Time        time.Time `json:"time"`
+	User        string    `json:"user,omitempty"`
+	Impersonate string    `json:"impersonate,omitempty"`
+	Namespace   string    `json:"namespace"`
+	Pod         string    `json:"pod"`
+	Container   string    `json:"container"`
+	Command     string    `json:"command"`
+	Arg         string    `json:"arg,omitempty"`
+	Status      string    `json:"status"`
+	Reason      string    `json:"reason"`
+	ExitCode    int       `json:"exitCode"`
+	Duration    float64   `json:"durationSeconds"`
+}
+
+// auditConfig returns the client config which the check used, or nil when
+// it failed to load it.
+func auditConfig(req *Request) *rest.Config {
+	if req.client != nil {
+		return req.client.config
+	}
+	config, err := loadClientConfig(req)
+	if err != nil {
+		return nil
+	}
+	return config
+}
+
+// writeAudit appends the results to the audit file, as JSON lines. The
+// identity is the one set in the client config: it is empty when
+// authenticating with a token or a client certificate, or when the config
+// failed to load. Failures are only logged, they don't change the check
+// result.
+func writeAudit(config *rest.Config, req *Request, results []Result) {
+	var user, impersonate string
+	if config != nil {
+		user, impersonate = config.Username, config.Impersonate.UserName
+	}
+	var data []byte
+	for _, r := range results {
+		line, err := json.Marshal(auditRecord{
+			Time:        time.Now(),
+			User:        user,
+			Impersonate: impersonate,
+			Namespace:   r.Namespace,
+			Pod:         r.Pod,
+			Container:   r.Container,
+			Command:     req.Command,
+			Arg:         req.Arg,
+			Status:      statusNames[r.Status],
+			Reason:      r.Reason,
+			ExitCode:    r.ExitCode,
+			Duration:    r.Duration.Seconds(),
+		})
+		if err != nil {
+			log.Printf("Failed to write audit file: %v", err)
+			return
+		}
+		data = append(append(data, line...), '\n')
+	}
+
+	file, err := os.OpenFile(req.auditFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err == nil {
+		_, err = file.Write(data)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		log.Printf("Failed to write audit file: %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// benchmarkSummary holds the exec latency percentiles and the success rate of
+// the iterations of a benchmark.
+type benchmarkSummary struct {
+	Iterations  int            `json:"iterations"`
+	Succeeded   int            `json:"succeeded"`
+	SuccessRate float64        `json:"successRate"`
+	P50         float64        `json:"p50Seconds"`
+	P90         float64        `json:"p90Seconds"`
+	P99         float64        `json:"p99Seconds"`
+	Statuses    map[string]int `json:"statuses"`
+}
+
+func (s benchmarkSummary) String() string {
+	return fmt.Sprintf("%v/%v iterations succeeded (%.1f%%), exec latency p50=%.3fs p90=%.3fs p99=%.3fs",
+		s.Succeeded, s.Iterations, s.SuccessRate*100, s.P50, s.P90, s.P99)
+}
+
+// percentile returns the nearest-rank percentile of the sorted durations.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// runBenchmark runs the whole check the given number of times, without cache,
+// and summarizes the durations of the execs which could be run. The client to
+// the API server is shared by the iterations. It stops early on SIGINT or
+// SIGTERM, or at the deadline.
+func runBenchmark(req *Request, iterations int) (benchmarkSummary, error) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if !req.deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, req.deadline)
+		defer cancel()
+	}
+
+	summary := benchmarkSummary{Statuses: map[string]int{}}
+	if err := req.shareClient(); err != nil {
+		return summary, err
+	}
+	var execs []time.Duration
+	for i := 0; i < iterations && ctx.Err() == nil; i++ {
+		checkCtx, cancel := ctx, func() {}
+		if req.Timeout > 0 {
+			checkCtx, cancel = context.WithTimeout(ctx, req.Timeout)
+		}
+		result := CheckKubeExec(checkCtx, req)
+		cancel()
+
+		summary.Iterations++
+		summary.Statuses[statusNames[result.Status]]++
+		if result.Status == "0" {
+			summary.Succeeded++
+		}
+		if result.Timings.Exec > 0 {
+			execs = append(execs, result.Timings.Exec)
+		}
+	}
+	if summary.Iterations < iterations {
+		log.Printf("Benchmark interrupted after %v iterations", summary.Iterations)
+	}
+
+	sort.Slice(execs, func(i, j int) bool { return execs[i] < execs[j] })
+	if summary.Iterations > 0 {
+		summary.SuccessRate = float64(summary.Succeeded) / float64(summary.Iterations)
+	}
+	summary.P50 = percentile(execs, 50).Seconds()
+	summary.P90 = percentile(execs, 90).Seconds()
+	summary.P99 = percentile(execs, 99).Seconds()
+	return summary, nil
+}
+
+// newBenchmarkCmd returns the benchmark subcommand, which shares the flags of
+// the check command.
+func newBenchmarkCmd(check *cobra.Command, req *Request) *cobra.Command {
+	var iterations int
+	c := &cobra.Command{
+		Use:   "benchmark",
+		Short: "Run the check several times and report the exec latency percentiles and success rate",
+
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if iterations < 1 {
+				return fmt.Errorf("Benchmark requires at least one iteration")
+			}
+			return check.PreRunE(cmd, args)
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			shutdownTracing := startTracing(req)
+			summary, err := runBenchmark(req, iterations)
+			shutdownTracing()
+			if err != nil {
+				log.Fatalf("%v", err)
+			}
+
+			if req.outputFormat == "json" {
+				data, err := json.Marshal(summary)
+				if err != nil {
+					log.Fatalf("Failed to format benchmark summary: %v", err)
+				}
+				fmt.Println(string(data))
+			} else {
+				fmt.Println(summary)
+			}
+		},
+	}
+
+	c.Flags().AddFlagSet(check.Flags())
+	c.Flags().IntVar(&iterations, "iterations", 10, "Number of times the check is run")
+	return c
+}
@@ -0,0 +1,141 @@
+package main
+
+// A circuit breaker, shared by the checks against the same API server, stops
+// connecting to it after several consecutive connection failures. Checks then
+// fail fast with UNKNOWN until the cooldown has passed, which avoids piling up
+// requests on an API server which is down or overloaded. The cooldown doubles
+// each time the first attempt after it fails again, up to a maximum, and is
+// reset by a successful connection. Its state is kept in a file so that it
+// spans the invocations scheduled by the monitoring system.
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/url"
+	"time"
+)
+
+type breakerState struct {
+	Failures int       `json:"failures"`
+	Trips    int       `json:"trips"`
+	OpenedAt time.Time `json:"openedAt"`
+}
+
+// cooldown returns the duration the breaker stays open for after its last
+// trip: the base cooldown, doubled for each consecutive trip, at most max.
+func (s *breakerState) cooldown(base, max time.Duration) time.Duration {
+	cooldown := base
+	for i := 1; i < s.Trips && cooldown < max; i++ {
+		cooldown *= 2
+	}
+	if cooldown > max {
+		return max
+	}
+	return cooldown
+}
+
+// isOpen reports whether the breaker is open, the checks failing fast.
+func (s *breakerState) isOpen(req *Request) bool {
+	return s.Failures >= req.breakerThreshold &&
+		time.Since(s.OpenedAt) < s.cooldown(req.breakerCooldown, req.breakerMaxCooldown)
+}
+
+// breakerPath returns the path of the file keeping the state of the breaker
+// of the API server.
+func breakerPath(req *Request) (string, error) {
+	key := fmt.Sprintf("%x", sha256.Sum256([]byte(req.masterURL+"\n"+req.kubeconfigPath)))
+	return statePath("breaker-" + key)
+}
+
+// isConnectionFailure reports whether the check failed to reach the API
+// server, as opposed to reaching it and getting an error back.
+func isConnectionFailure(result *Result) bool {
+	if result.Status != "UNKNOWN" || result.Err == nil {
+		return false
+	}
+	var urlErr *url.Error
+	var netErr net.Error
+	return errors.As(result.Err, &urlErr) || errors.As(result.Err, &netErr)
+}
+
+// updateBreaker applies fn to the breaker state stored in path.
+func updateBreaker(path string, fn func(state *breakerState)) (breakerState, error) {
+	var state breakerState
+
+	unlock, err := lockFile(path + ".lock")
+	if err != nil {
+		return state, err
+	}
+	defer unlock()
+
+	if data, err := ioutil.ReadFile(path); err == nil {
+		json.Unmarshal(data, &state)
+	}
+	if fn == nil {
+		return state, nil
+	}
+	fn(&state)
+	data, err := json.Marshal(state)
+	if err != nil {
+		return state, err
+	}
+	return state, ioutil.WriteFile(path, data, 0600)
+}
+
+// checkWithBreaker runs check unless the circuit breaker for the API server
+// is open, and records its connection failures.
+func checkWithBreaker(ctx context.Context, req *Request, check func(context.Context, *Request) *Result) *Result {
+	path, err := breakerPath(req)
+	if err != nil {
+		log.Printf("Circuit breaker disabled: %v", err)
+		return check(ctx, req)
+	}
+
+	state, err := updateBreaker(path, nil)
+	if err != nil {
+		log.Printf("Circuit breaker disabled: %v", err)
+		return check(ctx, req)
+	}
+	if state.isOpen(req) {
+		return errorResult(req, fmt.Errorf("[connection] Circuit breaker open after %v consecutive connection failures, next attempt after %v",
+			state.Failures, state.OpenedAt.Add(state.cooldown(req.breakerCooldown, req.breakerMaxCooldown)).Format(time.RFC3339)))
+	}
+
+	result := check(ctx, req)
+
+	failed := isConnectionFailure(result)
+	_, err = updateBreaker(path, func(state *breakerState) {
+		if !failed {
+			state.Failures, state.Trips = 0, 0
+			return
+		}
+		state.Failures++
+		if state.Failures >= req.breakerThreshold {
+			state.Trips++
+			state.OpenedAt = time.Now()
+			log.Printf("Circuit breaker open for %v after %v consecutive connection failures",
+				state.cooldown(req.breakerCooldown, req.breakerMaxCooldown), state.Failures)
+		}
+	})
+	if err != nil {
+		log.Printf("Failed to update circuit breaker: %v", err)
+	}
+
+	return result
+}
+
+// readBreaker returns the state of the breaker of the API server, for the
+// metrics.
+func readBreaker(req *Request) (breakerState, error) {
+	path, err := breakerPath(req)
+	if err != nil {
+		return breakerState{}, err
+	}
+	return updateBreaker(path, nil)
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBreakerCooldown(t *testing.T) {
+	for trips, cooldown := range map[int]time.Duration{
+		0:   time.Minute,
+		1:   time.Minute,
+		2:   2 * time.Minute,
+		3:   4 * time.Minute,
+		5:   10 * time.Minute,
+		100: 10 * time.Minute,
+	} {
+		state := breakerState{Trips: trips}
+		if got := state.cooldown(time.Minute, 10*time.Minute); got != cooldown {
+			t.Errorf("cooldown after %v trips %v instead of %v", trips, got, cooldown)
+		}
+	}
+}
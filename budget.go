@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// retryBudget caps the total time spent retrying during a check, whatever
+// is retried: the backoff delays and the retried operations are deducted
+// from it. A nil budget is unlimited. It is shared by the pods checked at
+// once.
+type retryBudget struct {
+	total time.Duration
+
+	mu        sync.Mutex
+	remaining time.Duration
+}
+
+func newRetryBudget(total time.Duration) *retryBudget {
+	if total <= 0 {
+		return nil
+	}
+	return &retryBudget{total: total, remaining: total}
+}
+
+// exhausted returns the error of a retry which does not fit in the budget.
+func (b *retryBudget) exhausted() error {
+	return withReason("timeout", fmt.Errorf("Retry budget of %v exhausted", b.total))
+}
+
+// wait waits for the delay before a retry, deducting it from the budget, or
+// fails without waiting if the budget does not allow it.
+func (b *retryBudget) wait(ctx context.Context, delay time.Duration) error {
+	if b == nil {
+		waitDelay(ctx, delay)
+		return nil
+	}
+	b.mu.Lock()
+	if delay >= b.remaining {
+		b.mu.Unlock()
+		return b.exhausted()
+	}
+	b.remaining -= delay
+	b.mu.Unlock()
+	waitDelay(ctx, delay)
+	return nil
+}
+
+// spend deducts the duration of a retried operation from the budget.
+func (b *retryBudget) spend(d time.Duration) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.remaining -= d
+}
+
+// allow fails if the budget is exhausted.
+func (b *retryBudget) allow() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.remaining <= 0 {
+		return b.exhausted()
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+package main
+
+// Results may be cached on disk so that identical checks launched by
+// concurrent monitoring threads run the exec command only once. A cached
+// result is returned as long as it is younger than the cache TTL: it can
+// therefore hide a change of state in the container during that window, so
+// the TTL should stay well below the check interval.
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// cachedResult holds a cached result, without its error which can't be
+// serialized. The output is kept as bytes, base64 encoded in JSON, which
+// preserves a binary output. Results holds the results of each pod or
+// namespace of an aggregated result, so that they are recorded on a cache hit
+// as they were when the check ran.
+type cachedResult struct {
+	Time      time.Time      `json:"time"`
+	Status    string         `json:"status"`
+	ExitCode  int            `json:"exitCode"`
+	Stdout    []byte         `json:"stdout"`
+	Stderr    []byte         `json:"stderr"`
+	Duration  time.Duration  `json:"duration"`
+	Timings   Timings        `json:"timings"`
+	Pod       string         `json:"pod"`
+	Container string         `json:"container"`
+	Namespace string         `json:"namespace"`
+	Message   string         `json:"message"`
+	Reason    string         `json:"reason"`
+	Results   []cachedResult `json:"results,omitempty"`
+}
+
+func newCachedResult(r *Result) cachedResult {
+	cached := cachedResult{
+		Status:    r.Status,
+		ExitCode:  r.ExitCode,
+		Stdout:    []byte(r.Stdout),
+		Stderr:    []byte(r.Stderr),
+		Duration:  r.Duration,
+		Timings:   r.Timings,
+		Pod:       r.Pod,
+		Container: r.Container,
+		Namespace: r.Namespace,
+		Message:   r.Message,
+		Reason:    r.Reason,
+	}
+	for i := range r.results {
+		cached.Results = append(cached.Results, newCachedResult(&r.results[i]))
+	}
+	return cached
+}
+
+func (c *cachedResult) result() *Result {
+	r := &Result{
+		Status:    c.Status,
+		ExitCode:  c.ExitCode,
+		Stdout:    string(c.Stdout),
+		Stderr:    string(c.Stderr),
+		Duration:  c.Duration,
+		Timings:   c.Timings,
+		Pod:       c.Pod,
+		Container: c.Container,
+		Namespace: c.Namespace,
+		Message:   c.Message,
+		Reason:    c.Reason,
+	}
+	for i := range c.Results {
+		r.results = append(r.results, *c.Results[i].result())
+	}
+	return r
+}
+
+// cacheable reports whether the result is the one of a completed check, which
+// may be reused. A check which could not complete, e.g. interrupted, timed out
+// or failing on an API error, is UNKNOWN or has an error, for itself or any of
+// its pods or namespaces, and is run again by the next identical check.
+func cacheable(ctx context.Context, result *Result) bool {
+	if ctx.Err() != nil || result.Status == "UNKNOWN" || result.Err != nil {
+		return false
+	}
+	for _, r := range result.records() {
+		if r.Status == "UNKNOWN" || r.Err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// statePath returns the path of a file keeping state across invocations, in
+// a directory of the user under the temporary directory. As another user may
+// have created it first, e.g. with a planted state file or symlink, it is
+// refused unless it is a directory owned by the user with mode 0700.
+func statePath(name string) (string, error) {
+	uid := os.Getuid()
+	dir := filepath.Join(os.TempDir(), fmt.Sprintf("checkexec-%v", uid))
+	if err := os.Mkdir(dir, 0700); err != nil && !os.IsExist(err) {
+		return "", err
+	}
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return "", err
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !info.IsDir() || !ok || int(stat.Uid) != uid || info.Mode().Perm() != 0700 {
+		return "", fmt.Errorf(`State directory "%v" must be a directory owned by UID %v with mode 0700`, dir, uid)
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// lockFile takes an exclusive lock on the file, waiting for concurrent holders
+// to release it.
+func lockFile(path string) (func(), error) {
+	lock, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX); err != nil {
+		lock.Close()
+		return nil, err
+	}
+	return func() {
+		syscall.Flock(int(lock.Fd()), syscall.LOCK_UN)
+		lock.Close()
+	}, nil
+}
+
+// cacheKey returns the cache key of the check, a hash of the settings which
+// define it: its target, command and evaluation. The settings of the run, such
+// as the outputs, the timeout, the deadline or the concurrency, are left out
+// so that identical checks share their result. A new setting changing the
+// result of the check must be added.
+func cacheKey(req *Request) string {
+	fields := []interface{}{
+		req.masterURL, req.kubeconfigPath, req.namespaceFile,
+
+		req.Pod, req.PodIP, req.StatefulSet, req.Ordinal, req.Deployment,
+		req.ReplicaSet, req.PodTemplateHash, req.Selector, req.AllPods,
+		req.ComparePods, req.Newest, req.ExpectSingle, req.Count, req.Compact,
+		req.FailFast,
+
+		req.Container, req.ContainerIndex, req.ContainerFallback, req.Logic,
+		req.ContainerCommands, req.Namespace, req.Namespaces, req.CheckNamespace,
+		req.PreExec, req.PreExecTimeout, req.Command, req.ShellFallback, req.OS,
+		req.Arg, req.CommandArgs, req.Template, req.RunAlias, req.CommandAliases,
+		req.AliasesFile, req.SoftTimeout, req.StdinSeparator, req.StdinBase64,
+		req.KeepStdinOpen, req.Workdir, req.CombineOutput, req.MeasureThroughput,
+		req.OutputOnSuccess, req.CollapseRepeated,
+
+		req.MinPodAge, req.MaxPodAge, req.TerminatingStatus, req.AllowedPhases,
+		req.MissingContainerStatus, req.ExpectLabel, req.FreshAnnotation,
+		req.MaxStaleness, req.ExpectHostname, req.ExpectLivenessPath,
+		req.ExpectReadinessPath, req.ExpectCPULimit, req.ProbeType, req.HTTPGet,
+		req.ExpectMemoryLimit, req.RunAsUID, req.RequireStarted,
+		req.TolerateNotReady, req.WaitSidecar, req.WaitSidecarTimeout,
+		req.NoRestartWithin, req.RequireRolloutComplete, req.RequireConditions,
+
+		req.Interpret, req.ShowEvents, req.ShowPDB, req.EmitEvent, req.Decompress,
+		req.ExpectOutput, req.MatchMode, req.NormalizeOutput, req.MismatchRetries,
+		req.MismatchBackoff, req.RetryBudget, req.ExpectJSONPath, req.PerfFromJSON,
+		req.StatusFromOutput, req.IgnoreExitCode, req.ExpectFile,
+		req.ExpectFileType, req.Strict, req.OkCodes, req.StatusMapFile,
+	}
+	data, _ := json.Marshal(fields)
+	return fmt.Sprintf("%x", sha256.Sum256(data))
+}
+
+// CheckKubeExecCached runs CheckKubeExec, reusing the result of an identical
+// check that completed less than req.cacheTTL ago, which is recorded as if the
+// check ran. Concurrent identical checks wait for the first one to complete
+// instead of running the exec again.
+func CheckKubeExecCached(ctx context.Context, req *Request) *Result {
+	if req.cacheTTL <= 0 {
+		return CheckKubeExec(ctx, req)
+	}
+
+	path, err := statePath("cache-" + cacheKey(req))
+	if err != nil {
+		log.Printf("Result cache disabled: %v", err)
+		return CheckKubeExec(ctx, req)
+	}
+
+	unlock, err := lockFile(path + ".lock")
+	if err != nil {
+		log.Printf("Result cache disabled: %v", err)
+		return CheckKubeExec(ctx, req)
+	}
+	defer unlock()
+
+	var cached cachedResult
+	if data, err := ioutil.ReadFile(path); err == nil && json.Unmarshal(data, &cached) == nil {
+		if time.Since(cached.Time) < req.cacheTTL {
+			log.Printf("Using result cached at %v", cached.Time.Format(time.RFC3339))
+			result := cached.result()
+			recordResult(req, result)
+			return result
+		}
+	}
+
+	result := CheckKubeExec(ctx, req)
+	if !cacheable(ctx, result) {
+		log.Printf("Result not cached as the check did not complete")
+		return result
+	}
+
+	cached = newCachedResult(result)
+	cached.Time = time.Now()
+	data, err := json.Marshal(cached)
+	if err == nil {
+		err = ioutil.WriteFile(path, data, 0600)
+	}
+	if err != nil {
+		log.Printf("Failed to cache result: %v", err)
+	}
+
+	return result
+}
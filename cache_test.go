@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCacheKey(t *testing.T) {
+	req := Request{Namespace: "default", Pod: "web-1", Command: "/bin/sh", Arg: "echo ok", cacheTTL: time.Minute}
+	key := cacheKey(&req)
+
+	// the settings of the run, not of the check, don't change the key
+	same := req
+	same.cacheTTL, same.deadline, same.budget = time.Hour, time.Now(), newRetryBudget(time.Minute)
+	same.client, same.textfileOutput, same.Timeout, same.Concurrency = &sharedClient{}, "/tmp/checkexec.prom", time.Second, 4
+	if cacheKey(&same) != key {
+		t.Error("cache key changed with the settings of the run")
+	}
+
+	for name, change := range map[string]func(r *Request){
+		"cluster":   func(r *Request) { r.masterURL = "https://other:6443" },
+		"namespace": func(r *Request) { r.Namespace = "other" },
+		"pod":       func(r *Request) { r.Pod = "web-2" },
+		"command":   func(r *Request) { r.Command = "/bin/bash" },
+		"arguments": func(r *Request) { r.Arg = "echo ko" },
+		"ok codes":  func(r *Request) { r.OkCodes = []int{0, 1} },
+	} {
+		other := req
+		change(&other)
+		if cacheKey(&other) == key {
+			t.Errorf("cache key unchanged with another %v", name)
+		}
+	}
+}
+
+func TestCacheable(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name      string
+		ctx       context.Context
+		result    Result
+		cacheable bool
+	}{
+		{"ok", context.Background(), Result{Status: "0"}, true},
+		{"critical", context.Background(), Result{Status: "2", ExitCode: 1}, true},
+		{"api error", context.Background(), Result{Status: "UNKNOWN", Err: errors.New("service unavailable")}, false},
+		{"interrupted", canceled, Result{Status: "2"}, false},
+		{"unknown pod", context.Background(), Result{Status: "2", results: []Result{{Status: "2"}, {Status: "UNKNOWN"}}}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if cacheable(test.ctx, &test.result) != test.cacheable {
+				t.Errorf("cacheable %v instead of %v", !test.cacheable, test.cacheable)
+			}
+		})
+	}
+}
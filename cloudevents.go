@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// cloudEventType is the type of the CloudEvents carrying a check result.
+const cloudEventType = "io.checkexec.result"
+
+// cloudEvent is a CloudEvent in the structured JSON format, whose data is the
+// JSON result of the check.
+type cloudEvent struct {
+	SpecVersion     string    `json:"specversion"`
+	ID              string    `json:"id"`
+	Source          string    `json:"source"`
+	Type            string    `json:"type"`
+	Subject         string    `json:"subject,omitempty"`
+	Time            time.Time `json:"time"`
+	DataContentType string    `json:"datacontenttype"`
+	Data            *Result   `json:"data"`
+}
+
+func newCloudEvent(result *Result) (*cloudEvent, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	event := &cloudEvent{
+		SpecVersion:     "1.0",
+		ID:              hex.EncodeToString(id),
+		Source:          "checkexec",
+		Type:            cloudEventType,
+		Time:            time.Now().UTC(),
+		DataContentType: "application/json",
+		Data:            result,
+	}
+	if result.Pod != "" {
+		event.Subject = fmt.Sprintf("%v/%v", result.Namespace, result.Pod)
+	}
+	return event, nil
+}
+
+// sendCloudEvent sends the result as a CloudEvent to the sink in the
+// background, while the result is output, and returns a function waiting for
+// the delivery to complete, within the webhook timeout. As the webhook, it is
+// best effort and does not change the result.
+func sendCloudEvent(req *Request, result *Result) func() {
+	if req.cloudEventsSink == "" {
+		return func() {}
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		event, err := newCloudEvent(result)
+		if err != nil {
+			log.Printf("Failed to create CloudEvent: %v", err)
+			return
+		}
+		data, err := json.Marshal(event)
+		if err != nil {
+			log.Printf("Failed to format CloudEvent: %v", err)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+		defer cancel()
+		httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, req.cloudEventsSink, bytes.NewReader(data))
+		if err != nil {
+			log.Printf("Failed to create CloudEvent request: %v", err)
+			return
+		}
+		httpReq.Header.Set("Content-Type", "application/cloudevents+json")
+		resp, err := http.DefaultClient.Do(httpReq)
+		if err != nil {
+			log.Printf("Failed to send CloudEvent: %v", err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			log.Printf("CloudEvents sink rejected the result: %v", resp.Status)
+		}
+	}()
+	return func() { <-done }
+}
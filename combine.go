@@ -0,0 +1,63 @@
+package main
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// streamChunk is a chunk of the output of an exec, with the time it arrived
+// at and its stream.
+type streamChunk struct {
+	time   time.Time
+	stderr bool
+	data   string
+}
+
+// combinedOutput merges the stdout and stderr streams of an exec, like
+// '2>&1'. The chunks of both streams are timestamped as they arrive, under a
+// single mutex, and emitted in arrival order, which approximates the way a
+// terminal interleaves them.
+type combinedOutput struct {
+	mu     sync.Mutex
+	chunks []streamChunk
+	rate   *outputRate
+}
+
+type combinedStream struct {
+	output *combinedOutput
+	stderr bool
+}
+
+// stream returns the writer of the stdout or stderr stream.
+func (o *combinedOutput) stream(stderr bool) io.Writer {
+	return &combinedStream{output: o, stderr: stderr}
+}
+
+func (s *combinedStream) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	now := time.Now()
+	s.output.mu.Lock()
+	defer s.output.mu.Unlock()
+	s.output.chunks = append(s.output.chunks, streamChunk{time: now, stderr: s.stderr, data: string(p)})
+	if s.output.rate != nil {
+		s.output.rate.add(len(p), now)
+	}
+	return len(p), nil
+}
+
+// String returns the chunks of both streams in arrival order.
+func (o *combinedOutput) String() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	sort.SliceStable(o.chunks, func(i, j int) bool { return o.chunks[i].time.Before(o.chunks[j].time) })
+	var output strings.Builder
+	for _, chunk := range o.chunks {
+		output.WriteString(chunk.data)
+	}
+	return output.String()
+}
@@ -0,0 +1,14 @@
+package main
+
+import "testing"
+
+func TestCombinedOutput(t *testing.T) {
+	combined := &combinedOutput{}
+	stdout, stderr := combined.stream(false), combined.stream(true)
+	stdout.Write([]byte("starting\n"))
+	stderr.Write([]byte("warning: deprecated\n"))
+	stdout.Write([]byte("ready\n"))
+	if output := combined.String(); output != "starting\nwarning: deprecated\nready\n" {
+		t.Errorf("combined output %q", output)
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"path"
+	"strings"
+	"text/template"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+var shells = map[string]bool{
+	"sh":   true,
+	"bash": true,
+	"ash":  true,
+	"dash": true,
+	"zsh":  true,
+}
+
+// stdinSeparators maps the stdin separator names to the separator joining
+// the tokens written to the exec command stdin.
+var stdinSeparators = map[string]string{
+	"newline": "\n",
+	"null":    "\x00",
+	"space":   " ",
+}
+
+// shellQuote quotes s as a single shell word.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// execCommandLine returns the command vector run by exec, and the lines
+// written to its stdin. A Windows shell gets its flag and arguments on the
+// command line. With a base64 stdin payload or a working directory, the
+// command is run by a shell, the payload being written as is. A command
+// vector is run as is. With a stdin separator other than newline, the
+// argument tokens are written to stdin, otherwise "-c" and the arguments
+// are.
+func execCommandLine(req *Request) ([]string, []string, error) {
+	if flag, ok := windowsShells[strings.ToLower(path.Base(req.Command))]; ok {
+		return []string{req.Command, flag, req.Arg}, nil, nil
+	}
+	if req.StdinBase64 != "" {
+		payload, err := base64.StdEncoding.DecodeString(req.StdinBase64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("[config] Invalid base64 stdin: %w", err)
+		}
+		return shellCommand(req), []string{string(payload)}, nil
+	}
+	if req.Workdir != "" {
+		return shellCommand(req), nil, nil
+	}
+	if len(req.CommandArgs) > 0 {
+		return req.CommandArgs, nil, nil
+	}
+	if req.StdinSeparator != "" && req.StdinSeparator != "newline" {
+		return []string{req.Command}, stdinTokens(req.Arg), nil
+	}
+	return []string{req.Command}, []string{"-c", req.Arg}, nil
+}
+
+// stdinTokens splits the arguments into the tokens written to stdin, at ';'
+// as in 'arg; arg; arg', dropping the empty ones.
+func stdinTokens(arg string) []string {
+	var tokens []string
+	for _, token := range strings.Split(arg, ";") {
+		if token = strings.TrimSpace(token); token != "" {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens
+}
+
+// kubectlCommand returns the kubectl exec command line equivalent to the exec
+// of the command in the container, to reproduce it by hand. The stdin lines
+// are piped to it.
+func kubectlCommand(req *Request, pod, container string, command, stdinLines []string) string {
+	words := []string{"kubectl"}
+	if req.kubeconfigPath != "" {
+		words = append(words, "--kubeconfig", shellQuote(req.kubeconfigPath))
+	}
+	if req.masterURL != "" {
+		words = append(words, "--server", shellQuote(req.masterURL))
+	}
+	words = append(words, "exec")
+	if len(stdinLines) > 0 {
+		words = append(words, "-i")
+	}
+	words = append(words, "-n", shellQuote(req.Namespace), shellQuote(pod), "-c", shellQuote(container), "--")
+	for _, arg := range command {
+		words = append(words, shellQuote(arg))
+	}
+	line := strings.Join(words, " ")
+	if len(stdinLines) > 0 {
+		stdin := strings.Join(stdinLines, stdinSeparators[req.StdinSeparator])
+		line = fmt.Sprintf("printf '%%s' %v | %v", shellQuote(stdin), line)
+	}
+	return line
+}
+
+// setCommandArgs sets the exec command vector from the positional arguments,
+// superseding the command and arguments flags. The command and its arguments
+// are still derived from it for the allowlist, the exit code interpretation
+// and the Windows shell replacement, the script of "sh -c" being the
+// arguments of the shell.
+func setCommandArgs(req *Request, args []string) {
+	req.CommandArgs = args
+	req.Command, req.Arg = args[0], strings.Join(args[1:], " ")
+	if shells[path.Base(args[0])] && len(args) == 3 && args[1] == "-c" {
+		req.Arg = args[2]
+	}
+}
+
+// shellCommand wraps the command in a shell, which changes to the working
+// directory first if any, since exec does not allow to set it. When the command
+// already is a shell, its arguments are run as the script.
+func shellCommand(req *Request) []string {
+	shell, script := "/bin/sh", req.Command
+	if shells[path.Base(req.Command)] {
+		shell, script = req.Command, req.Arg
+	} else if len(req.CommandArgs) > 0 {
+		words := make([]string, len(req.CommandArgs))
+		for i, arg := range req.CommandArgs {
+			words[i] = shellQuote(arg)
+		}
+		script = strings.Join(words, " ")
+	}
+	if req.Workdir != "" {
+		script = "cd " + shellQuote(req.Workdir) + " && " + script
+	}
+	return []string{shell, "-c", script}
+}
+
+// podTemplateData holds the pod metadata available to the command templates.
+type podTemplateData struct {
+	Name        string
+	Namespace   string
+	Labels      map[string]string
+	Annotations map[string]string
+}
+
+// isCommandTemplate reports whether the command is to be rendered: templating
+// is enabled and the command or its arguments hold an action.
+func isCommandTemplate(req *Request) bool {
+	return req.Template && (strings.Contains(req.Command, "{{") || strings.Contains(req.Arg, "{{") ||
+		strings.Contains(strings.Join(req.CommandArgs, " "), "{{"))
+}
+
+func parseCommandTemplate(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf(`Invalid %v template "%v": %w`, name, text, err)
+	}
+	return tmpl, nil
+}
+
+// validateCommandTemplate parses the command templates so that an invalid one
+// is reported before connecting to the cluster.
+func validateCommandTemplate(req *Request) error {
+	if _, err := parseCommandTemplate("command", req.Command); err != nil {
+		return err
+	}
+	for _, arg := range req.CommandArgs {
+		if _, err := parseCommandTemplate("argument", arg); err != nil {
+			return err
+		}
+	}
+	_, err := parseCommandTemplate("arguments", req.Arg)
+	return err
+}
+
+// renderCommand returns the request with the command and its arguments
+// rendered as templates of the pod metadata, e.g. "{{.Name}}" or
+// "{{.Labels.app}}", if templating is enabled. A missing label or annotation
+// is an error.
+func renderCommand(req *Request, pod *corev1.Pod) (*Request, error) {
+	if !isCommandTemplate(req) {
+		return req, nil
+	}
+	data := podTemplateData{
+		Name:        pod.Name,
+		Namespace:   pod.Namespace,
+		Labels:      pod.Labels,
+		Annotations: pod.Annotations,
+	}
+	rendered := *req
+	rendered.CommandArgs = append([]string(nil), req.CommandArgs...)
+	type templateField struct {
+		name  string
+		value *string
+	}
+	fields := []templateField{{"command", &rendered.Command}, {"arguments", &rendered.Arg}}
+	for i := range rendered.CommandArgs {
+		fields = append(fields, templateField{"argument", &rendered.CommandArgs[i]})
+	}
+	for _, field := range fields {
+		tmpl, err := parseCommandTemplate(field.name, *field.value)
+		if err != nil {
+			return nil, err
+		}
+		var out bytes.Buffer
+		if err := tmpl.Execute(&out, data); err != nil {
+			return nil, fmt.Errorf("Failed to render %v template: %w", field.name, err)
+		}
+		*field.value = out.String()
+	}
+	return &rendered, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSetCommandArgs(t *testing.T) {
+	tests := []struct {
+		args    []string
+		command string
+		arg     string
+	}{
+		{[]string{"sh", "-c", "echo ok"}, "sh", "echo ok"},
+		{[]string{"/bin/bash", "-c", "test -f /tmp/x"}, "/bin/bash", "test -f /tmp/x"},
+		{[]string{"pg_isready", "-q", "-h", "localhost"}, "pg_isready", "-q -h localhost"},
+		{[]string{"true"}, "true", ""},
+	}
+	for _, test := range tests {
+		req := &Request{Command: "/bin/sh"}
+		setCommandArgs(req, test.args)
+		if !reflect.DeepEqual(req.CommandArgs, test.args) || req.Command != test.command || req.Arg != test.arg {
+			t.Errorf("setCommandArgs(%q) set vector %q, command %q and arguments %q", test.args, req.CommandArgs, req.Command, req.Arg)
+		}
+	}
+}
+
+func TestExecCommandLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     Request
+		command []string
+		stdin   []string
+	}{
+		{"shell script on stdin", Request{Command: "/bin/sh", Arg: "echo ok", StdinSeparator: "newline"},
+			[]string{"/bin/sh"}, []string{"-c", "echo ok"}},
+		{"command vector", Request{Command: "sh", Arg: "echo ok", CommandArgs: []string{"sh", "-c", "echo ok"}},
+			[]string{"sh", "-c", "echo ok"}, nil},
+		{"working directory", Request{Command: "/bin/sh", Arg: "echo ok", Workdir: "/tmp"},
+			[]string{"/bin/sh", "-c", "cd '/tmp' && echo ok"}, nil},
+		{"working directory of a command vector", Request{Command: "ls", Arg: "-l", CommandArgs: []string{"ls", "-l"}, Workdir: "/var/log"},
+			[]string{"/bin/sh", "-c", "cd '/var/log' && 'ls' '-l'"}, nil},
+		{"windows shell", Request{Command: "cmd", Arg: "echo ok"},
+			[]string{"cmd", "/c", "echo ok"}, nil},
+		{"base64 stdin", Request{Command: "cat", StdinBase64: "b2sK"},
+			[]string{"/bin/sh", "-c", "cat"}, []string{"ok\n"}},
+		{"null separated tokens", Request{Command: "xargs", Arg: "a; b ;; c", StdinSeparator: "null"},
+			[]string{"xargs"}, []string{"a", "b", "c"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			command, stdin, err := execCommandLine(&test.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(command, test.command) || !reflect.DeepEqual(stdin, test.stdin) {
+				t.Errorf("got command %q and stdin %q, want %q and %q", command, stdin, test.command, test.stdin)
+			}
+		})
+	}
+}
+
+func TestExecCommandLineInvalidBase64(t *testing.T) {
+	if _, _, err := execCommandLine(&Request{Command: "cat", StdinBase64: "not base64!"}); err == nil {
+		t.Error("invalid base64 stdin accepted")
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// maxDiffLine is the length beyond which the lines of a diff snippet are
+// truncated.
+const maxDiffLine = 80
+
+// diffSnippet describes the first line where the output differs from the
+// reference one.
+func diffSnippet(reference, output string) string {
+	refLines, lines := strings.Split(reference, "\n"), strings.Split(output, "\n")
+	for i := 0; i < len(refLines) || i < len(lines); i++ {
+		var refLine, line string
+		if i < len(refLines) {
+			refLine = refLines[i]
+		}
+		if i < len(lines) {
+			line = lines[i]
+		}
+		if i >= len(refLines) || i >= len(lines) || refLine != line {
+			return fmt.Sprintf("line %v: %q instead of %q", i+1, truncateLine(line), truncateLine(refLine))
+		}
+	}
+	return "same output"
+}
+
+func truncateLine(line string) string {
+	if len(line) > maxDiffLine {
+		return line[:maxDiffLine] + "..."
+	}
+	return line
+}
+
+// comparePods runs the check against every pod and compares the normalized
+// stdout of the pods where the exec command ran: the output shared by most
+// pods, or else by the first one, is the reference, and the pods diverging
+// from it make the check CRITICAL. The pods failing the check on their own
+// are reported as they would be by checkPods.
+func comparePods(ctx context.Context, config *rest.Config, kubeClient *kubernetes.Clientset, req *Request, pods []*corev1.Pod, timings Timings) *Result {
+	worst, reason := "0", "ok"
+	var failed []string
+	var compared []Result
+	outputs := map[string]int{}
+	start := time.Now()
+	for i, pod := range pods {
+		if i > 0 {
+			waitDelay(ctx, req.Delay)
+		}
+		result := checkPod(ctx, config, kubeClient, req, pod, timings)
+		if statusSeverity[result.Status] > statusSeverity[worst] {
+			worst, reason = result.Status, result.Reason
+		}
+		if result.Status != "0" {
+			failed = append(failed, fmt.Sprintf("%v(%v)", pod.Name, statusNames[result.Status]))
+		}
+		if result.ExitCode >= 0 {
+			result.Stdout = normalizeOutput(req, result.Stdout)
+			compared = append(compared, result)
+			outputs[result.Stdout]++
+		}
+	}
+
+	batch := time.Since(start)
+	result := &Result{
+		Status:    worst,
+		ExitCode:  -1,
+		Duration:  timings.Config + timings.PodGet + batch,
+		Timings:   Timings{Config: timings.Config, PodGet: timings.PodGet, Exec: batch},
+		Namespace: req.Namespace,
+		Reason:    reason,
+	}
+	if len(compared) < 2 {
+		err := fmt.Errorf("%v/%v pods ran the command, nothing to compare", len(compared), len(pods))
+		if len(failed) > 0 {
+			err = fmt.Errorf("%w: %v", err, strings.Join(failed, ", "))
+		}
+		result.Status = "UNKNOWN"
+		result.setOutput(err)
+		return result
+	}
+
+	var reference *Result
+	for i := range compared {
+		if reference == nil || outputs[compared[i].Stdout] > outputs[reference.Stdout] {
+			reference = &compared[i]
+		}
+	}
+	var diverged, details []string
+	for _, r := range compared {
+		if r.Stdout != reference.Stdout {
+			diverged = append(diverged, r.Pod)
+			details = append(details, fmt.Sprintf("%v: %v", r.Pod, diffSnippet(reference.Stdout, r.Stdout)))
+		}
+	}
+
+	summary := fmt.Sprintf("Outputs of %v pods match", len(compared))
+	if len(diverged) > 0 {
+		summary = fmt.Sprintf("%v/%v pods diverged from %v: %v", len(diverged), len(compared), reference.Pod, strings.Join(diverged, ", "))
+		result.Status, result.Reason = "2", "output-mismatch"
+	}
+	if len(failed) > 0 {
+		summary = fmt.Sprintf("%v, %v/%v pods failed: %v", summary, len(failed), len(pods), strings.Join(failed, ", "))
+	}
+	perfData := fmt.Sprintf("compared=%v diverged=%v", len(compared), len(diverged))
+	result.Message = fmt.Sprintf("%v | %v", summary, perfData)
+	if len(details) > 0 {
+		result.Message = fmt.Sprintf("%v\n%v", result.Message, strings.Join(details, "\n"))
+	}
+	return result
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"runtime"
+	"sync"
+)
+
+// podWorkersPerProc is the number of pods checked at once per processor with
+// --concurrency 0. A check mostly waits for the API server and the kubelet, so
+// that it takes several checks to keep a processor busy.
+const podWorkersPerProc = 4
+
+// podWorkers returns the number of pods checked at once by a check of all
+// pods: the concurrency, 1 by default, or min(pods, 4 * GOMAXPROCS) when it is
+// 0. The latter falls back to 1 with a delay or fail fast, which need the pods
+// to be checked in turn, and with the per-pod diagnostics written to stderr,
+// which would interleave: --dump-pod, --print-kubectl and the fields of the
+// JSON logs, shared by all the checks.
+func podWorkers(req *Request, pods int) int {
+	if req.Concurrency > 0 {
+		return req.Concurrency
+	}
+	if req.Delay > 0 || req.FailFast || hasPodDiagnostics(req) {
+		return 1
+	}
+	workers := podWorkersPerProc * runtime.GOMAXPROCS(0)
+	if pods < workers {
+		return pods
+	}
+	return workers
+}
+
+// forEachPod calls check with the index of each of the pods, running up to
+// workers calls at once, and returns once all of them are done.
+func forEachPod(pods, workers int, check func(i int)) {
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < pods; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				check(i)
+			}
+		}()
+	}
+	for i := 0; i < pods; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
+
+// hasPodDiagnostics reports whether the check writes diagnostics of the pod
+// being checked to stderr, which only make sense with one pod checked at once.
+func hasPodDiagnostics(req *Request) bool {
+	return req.dumpPod || req.printKubectl || req.logFormat == "json"
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestPodWorkers(t *testing.T) {
+	procs := podWorkersPerProc * runtime.GOMAXPROCS(0)
+	tests := []struct {
+		name    string
+		req     Request
+		pods    int
+		workers int
+	}{
+		{"explicit", Request{Concurrency: 3}, 10, 3},
+		{"automatic", Request{}, 2, 2},
+		{"automatic capped", Request{}, procs + 1, procs},
+		{"automatic with delay", Request{Delay: time.Second}, 10, 1},
+		{"automatic with fail fast", Request{FailFast: true}, 10, 1},
+		{"automatic with pod dump", Request{dumpPod: true}, 10, 1},
+		{"automatic with json logs", Request{logFormat: "json"}, 10, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if workers := podWorkers(&test.req, test.pods); workers != test.workers {
+				t.Errorf("%v workers for %v pods instead of %v", workers, test.pods, test.workers)
+			}
+		})
+	}
+}
+
+func TestConcurrencyDefault(t *testing.T) {
+	c := NewCmd()
+	if concurrency, _ := c.Flags().GetInt("concurrency"); concurrency != 1 {
+		t.Errorf("default concurrency %v instead of 1", concurrency)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// checkContainers runs the check in each container of the pod and aggregates
+// the results: with the "and" logic to the worst status, so that all of the
+// containers must pass, and with the "or" logic to the best one, so that a
+// single container passing is enough. With fail fast and the "and" logic, the
+// first CRITICAL container skips the remaining ones.
+func checkContainers(ctx context.Context, config *rest.Config, kubeClient *kubernetes.Clientset, req *Request, pod *corev1.Pod, containers []string, timings Timings) Result {
+	result := Result{Pod: pod.Name, Container: strings.Join(containers, ","), Namespace: req.Namespace, ExitCode: -1}
+	var passed, failed []string
+	start := time.Now()
+	for i, name := range containers {
+		if i > 0 {
+			waitDelay(ctx, req.Delay)
+		}
+		containerReq := *req
+		containerReq.Container, containerReq.ContainerIndex = name, -1
+		containerReq.ContainerFallback, containerReq.Logic = nil, ""
+		if command, ok := containerCommand(req, name); ok {
+			setCommandArgs(&containerReq, command)
+		}
+		log.Printf(`Running "%v" in container "%v"`, containerReq.Command, name)
+		r := checkPod(ctx, config, kubeClient, &containerReq, pod, timings)
+
+		better := statusSeverity[r.Status] < statusSeverity[result.Status]
+		worse := statusSeverity[r.Status] > statusSeverity[result.Status]
+		if i == 0 || (req.Logic == "and" && worse) || (req.Logic == "or" && better) {
+			result.Status, result.Reason = r.Status, r.Reason
+		}
+
+		if r.Status == "0" {
+			passed = append(passed, name)
+			continue
+		}
+		message := strings.SplitN(r.Message, " | ", 2)[0]
+		failed = append(failed, fmt.Sprintf("%v (%v - %v)", name, statusNames[r.Status], message))
+		if req.FailFast && req.Logic == "and" && r.Status == "2" {
+			break
+		}
+	}
+
+	batch := time.Since(start)
+	result.Duration = timings.Config + timings.PodGet + batch
+	result.Timings = Timings{Config: timings.Config, PodGet: timings.PodGet, Exec: batch}
+
+	message := fmt.Sprintf("%v/%v containers passed", len(passed), len(containers))
+	if len(passed) > 0 {
+		message = fmt.Sprintf("%v, passed: %v", message, strings.Join(passed, ", "))
+	}
+	if len(failed) > 0 {
+		message = fmt.Sprintf("%v, failed: %v", message, strings.Join(failed, ", "))
+	}
+	if skipped := len(containers) - len(passed) - len(failed); skipped > 0 {
+		message = fmt.Sprintf("%v, %v skipped after the first CRITICAL", message, skipped)
+	}
+	result.setOutput(fmt.Sprintf("%v | ok=%v fail=%v batch_time=%.3fs", message, len(passed), len(failed), batch.Seconds()))
+	return result
+}
+
+// parseContainerCommand splits the per-container command into the container
+// name and the command vector, the command line being split at whitespace.
+func parseContainerCommand(spec string) (string, []string) {
+	kv := strings.SplitN(spec, "=", 2)
+	if len(kv) != 2 {
+		return kv[0], nil
+	}
+	return kv[0], strings.Fields(kv[1])
+}
+
+// containerCommand returns the exec command vector overriding the default
+// command and its arguments for the container, if any.
+func containerCommand(req *Request, container string) ([]string, bool) {
+	for _, spec := range req.ContainerCommands {
+		if name, command := parseContainerCommand(spec); name == container {
+			return command, true
+		}
+	}
+	return nil, false
+}
+
+// validateContainerCommands checks the per-container command overrides, which
+// only apply when checking all the containers with a logic.
+func validateContainerCommands(req *Request) error {
+	if len(req.ContainerCommands) > 0 && req.Logic == "" {
+		return fmt.Errorf("Container commands require a container logic")
+	}
+	seen := map[string]bool{}
+	for _, spec := range req.ContainerCommands {
+		name, command := parseContainerCommand(spec)
+		if name == "" || len(command) == 0 {
+			return fmt.Errorf(`Invalid container command "%v" [Format: 'container=command arg arg']`, spec)
+		}
+		if seen[name] {
+			return fmt.Errorf(`Duplicate command for container "%v"`, name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
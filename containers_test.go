@@ -0,0 +1,32 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestContainerCommand(t *testing.T) {
+	req := &Request{Logic: "and", ContainerCommands: []string{"app=/healthcheck --flag", "sidecar=/ping"}}
+	if err := validateContainerCommands(req); err != nil {
+		t.Fatal(err)
+	}
+	for container, want := range map[string][]string{
+		"app":     {"/healthcheck", "--flag"},
+		"sidecar": {"/ping"},
+	} {
+		if command, ok := containerCommand(req, container); !ok || !reflect.DeepEqual(command, want) {
+			t.Errorf("container %v command %q instead of %q", container, command, want)
+		}
+	}
+	if _, ok := containerCommand(req, "db"); ok {
+		t.Error("command found for a container without override")
+	}
+}
+
+func TestValidateContainerCommandsInvalid(t *testing.T) {
+	for _, spec := range []string{"app", "=/healthcheck", "app=", "app=  "} {
+		if err := validateContainerCommands(&Request{Logic: "and", ContainerCommands: []string{spec}}); err == nil {
+			t.Errorf("container command %q accepted", spec)
+		}
+	}
+}
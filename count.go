@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// checkPodCount runs the check against the pod req.Count times back-to-back,
+// without stopping at the first failure, and aggregates the results to the
+// worst status. The performance data holds the minimum, average and maximum
+// exec durations. With fail fast, the first CRITICAL iteration skips the
+// remaining ones.
+func checkPodCount(ctx context.Context, config *rest.Config, kubeClient *kubernetes.Clientset, req *Request, pod *corev1.Pod, timings Timings) Result {
+	var result Result
+	var details []string
+	var failed, iterations int
+	var minExec, maxExec, totalExec time.Duration
+	for i := 0; i < req.Count; i++ {
+		r := checkPod(ctx, config, kubeClient, req, pod, timings)
+		iterations++
+		if i == 0 || statusSeverity[r.Status] > statusSeverity[result.Status] {
+			// the worst iteration is reported in the textfile metrics
+			result = r
+		}
+		if r.Status != "0" {
+			failed++
+		}
+
+		if i == 0 || r.Timings.Exec < minExec {
+			minExec = r.Timings.Exec
+		}
+		if r.Timings.Exec > maxExec {
+			maxExec = r.Timings.Exec
+		}
+		totalExec += r.Timings.Exec
+
+		message := strings.SplitN(r.Message, " | ", 2)[0]
+		details = append(details, fmt.Sprintf("#%v: %v - %v (exec %.3fs)", i+1, statusNames[r.Status], message, r.Timings.Exec.Seconds()))
+		if req.FailFast && r.Status == "2" {
+			break
+		}
+	}
+
+	summary := fmt.Sprintf("%v/%v iterations failed", failed, req.Count)
+	if skipped := req.Count - iterations; skipped > 0 {
+		summary = fmt.Sprintf("%v, %v skipped after the first CRITICAL", summary, skipped)
+	}
+	avgExec := totalExec / time.Duration(iterations)
+	result.setOutput(fmt.Sprintf("%v | ok=%v fail=%v exec_time_min=%.3fs exec_time_avg=%.3fs exec_time_max=%.3fs\n%v",
+		summary, iterations-failed, failed, minExec.Seconds(), avgExec.Seconds(), maxExec.Seconds(), strings.Join(details, "\n")))
+	return result
+}
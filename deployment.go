@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// resolveDeployment fetches the deployment and sets the selector of the
+// request to its one, so that its pods are checked.
+func resolveDeployment(ctx context.Context, kubeClient *kubernetes.Clientset, req *Request) (*appsv1.Deployment, error) {
+	deployment, err := kubeClient.AppsV1().Deployments(req.Namespace).Get(ctx, req.Deployment, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf(`Failed to get deployment "%v": %w`, req.Deployment, err)
+	}
+	selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil {
+		return nil, fmt.Errorf(`Invalid selector of deployment "%v": %w`, req.Deployment, err)
+	}
+	req.Selector = selector.String()
+	log.Printf(`Deployment "%v" selects "%v"`, deployment.Name, req.Selector)
+	return deployment, nil
+}
+
+// checkRollout warns if a rollout of the deployment is in progress, as long as
+// its replicas are not all updated and available.
+func checkRollout(deployment *appsv1.Deployment) (string, string) {
+	status := deployment.Status
+	summary := fmt.Sprintf("%v/%v replicas updated, %v available", status.UpdatedReplicas, status.Replicas, status.AvailableReplicas)
+	if status.UpdatedReplicas != status.Replicas || status.AvailableReplicas != status.Replicas {
+		return "1", fmt.Sprintf(`Deployment "%v" rollout in progress: %v`, deployment.Name, summary)
+	}
+	return "0", fmt.Sprintf(`Deployment "%v" rollout complete: %v`, deployment.Name, summary)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+const envPrefix = "CHECKEXEC_"
+
+// envName returns the environment variable providing the default value of a
+// flag, e.g. CHECKEXEC_NAMESPACE for --namespace.
+func envName(flag string) string {
+	return envPrefix + strings.ToUpper(strings.Replace(flag, "-", "_", -1))
+}
+
+// lockedFlags are the flags which the command line cannot override once set
+// by their environment variable, as they restrict what the check definitions
+// may run.
+var lockedFlags = map[string]bool{
+	"allowed-commands-file": true,
+}
+
+// bindEnv sets the flags not given on the command line from their environment
+// variable, if any, so that explicit flags take precedence over the
+// environment, which takes precedence over the flag defaults. A locked flag
+// given on the command line must have the value of its environment variable.
+func bindEnv(flags *pflag.FlagSet) error {
+	var err error
+	flags.VisitAll(func(flag *pflag.Flag) {
+		if err != nil || flag.Name == "help" {
+			return
+		}
+		if flag.Changed {
+			if value, ok := os.LookupEnv(envName(flag.Name)); ok && lockedFlags[flag.Name] && flag.Value.String() != value {
+				err = fmt.Errorf("--%v cannot override %v", flag.Name, envName(flag.Name))
+			}
+			return
+		}
+		if value, ok := os.LookupEnv(envName(flag.Name)); ok {
+			if setErr := flags.Set(flag.Name, value); setErr != nil {
+				err = fmt.Errorf("Invalid value %q for %v: %w", value, envName(flag.Name), setErr)
+			}
+		}
+	})
+	return err
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+)
+
+// maxEvents bounds the number of events added to the output.
+const maxEvents = 3
+
+// eventInterval is the minimum interval between two updates of the event
+// recording the same failure, so that frequent checks don't flood the API
+// server.
+const eventInterval = time.Minute
+
+const eventComponent = "checkexec"
+
+// podWarningEvents returns the most recent warning events of the pod, which
+// often explain a failed check, e.g. "FailedMount" or "Unhealthy".
+func podWarningEvents(ctx context.Context, kubeClient *kubernetes.Clientset, req *Request, pod string) ([]corev1.Event, error) {
+	list, err := kubeClient.CoreV1().Events(req.Namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.Set{
+			"involvedObject.kind": "Pod",
+			"involvedObject.name": pod,
+			"type":                corev1.EventTypeWarning,
+		}.String(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf(`Failed to list events of pod "%v": %w`, pod, err)
+	}
+
+	events := list.Items
+	sort.Slice(events, func(i, j int) bool {
+		return eventTime(&events[i]).After(eventTime(&events[j]))
+	})
+	if len(events) > maxEvents {
+		events = events[:maxEvents]
+	}
+	return events, nil
+}
+
+// eventTime returns the time the event last occurred, which depends on the
+// API used to record it.
+func eventTime(event *corev1.Event) time.Time {
+	switch {
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp.Time
+	case !event.EventTime.IsZero():
+		return event.EventTime.Time
+	default:
+		return event.CreationTimestamp.Time
+	}
+}
+
+// addEvents adds the recent warning events of the pod to the output of a
+// failed check.
+func addEvents(ctx context.Context, kubeClient *kubernetes.Clientset, req *Request, result Result) Result {
+	events, err := podWarningEvents(ctx, kubeClient, req, result.Pod)
+	if err != nil {
+		log.Print(err)
+		return result
+	}
+	if len(events) == 0 {
+		return result
+	}
+
+	summaries := make([]string, len(events))
+	for i, event := range events {
+		summaries[i] = fmt.Sprintf("%v: %v", event.Reason, strings.TrimSpace(event.Message))
+	}
+	return appendOutput(result, "events: "+strings.Join(summaries, "; "))
+}
+
+// appendOutput appends the text to the output of the result. An error output
+// is wrapped so that its cause is kept, and the text of a message goes before
+// its performance data.
+func appendOutput(result Result, text string) Result {
+	if result.Err != nil {
+		result.setOutput(fmt.Errorf("%w, %v", result.Err, text))
+		return result
+	}
+	parts := strings.SplitN(result.Message, " | ", 2)
+	parts[0] = fmt.Sprintf("%v, %v", parts[0], text)
+	result.Message = strings.Join(parts, " | ")
+	return result
+}
+
+// emitEvent records the failed check as a Warning event of the pod. As the
+// event recorder of client-go does, identical failures are aggregated in a
+// single event whose count is incremented, at most once per eventInterval.
+func emitEvent(ctx context.Context, kubeClient *kubernetes.Clientset, pod *corev1.Pod, result Result) {
+	message := fmt.Sprintf("Check %v: %v", statusNames[result.Status], strings.SplitN(result.Message, " | ", 2)[0])
+	if len(message) > 1024 {
+		message = message[:1024]
+	}
+	sum := sha256.Sum256([]byte(message))
+	name := fmt.Sprintf("%v.%v.%x", pod.Name, eventComponent, sum[:8])
+	now := metav1.Now()
+
+	events := kubeClient.CoreV1().Events(pod.Namespace)
+	event, err := events.Get(ctx, name, metav1.GetOptions{})
+	switch {
+	case err == nil:
+		if now.Sub(event.LastTimestamp.Time) < eventInterval {
+			return
+		}
+		event.Count++
+		event.LastTimestamp = now
+		_, err = events.Update(ctx, event, metav1.UpdateOptions{})
+	case apierrors.IsNotFound(err):
+		host, _ := os.Hostname()
+		_, err = events.Create(ctx, &corev1.Event{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: pod.Namespace},
+			InvolvedObject: corev1.ObjectReference{
+				Kind:            "Pod",
+				APIVersion:      "v1",
+				Name:            pod.Name,
+				Namespace:       pod.Namespace,
+				UID:             pod.UID,
+				ResourceVersion: pod.ResourceVersion,
+				FieldPath:       containerFieldPath(pod, result.Container),
+			},
+			Reason:              "CheckFailed",
+			Message:             message,
+			Type:                corev1.EventTypeWarning,
+			Source:              corev1.EventSource{Component: eventComponent, Host: host},
+			ReportingController: eventComponent,
+			ReportingInstance:   host,
+			FirstTimestamp:      now,
+			LastTimestamp:       now,
+			Count:               1,
+		}, metav1.CreateOptions{})
+	}
+	if err != nil {
+		log.Printf(`Failed to emit event on pod "%v": %v`, pod.Name, err)
+	}
+}
+
+// containerFieldPath returns the field path of the container in the pod spec,
+// or an empty path for the whole pod.
+func containerFieldPath(pod *corev1.Pod, container string) string {
+	for _, c := range pod.Spec.Containers {
+		if c.Name == container {
+			return fmt.Sprintf("spec.containers{%v}", container)
+		}
+	}
+	return ""
+}
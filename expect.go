@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// parseExpectJSONPath splits a "{expression}=value" output expectation, as
+// used by "kubectl wait --for=jsonpath". Without value, the expression only
+// has to match.
+func parseExpectJSONPath(expectJSONPath string) (*jsonpath.JSONPath, string, bool, error) {
+	expression, value, hasValue := expectJSONPath, "", false
+	if end := strings.LastIndex(expectJSONPath, "}"); end >= 0 && strings.HasPrefix(expectJSONPath[end+1:], "=") {
+		expression, value, hasValue = expectJSONPath[:end+1], expectJSONPath[end+2:], true
+	}
+	path, err := parseJSONPath(expression)
+	return path, value, hasValue, err
+}
+
+// parseJSONPath parses a JSONPath expression, with or without the enclosing
+// braces.
+func parseJSONPath(expression string) (*jsonpath.JSONPath, error) {
+	if !strings.HasPrefix(expression, "{") {
+		expression = "{" + expression + "}"
+	}
+	path := jsonpath.New(expression)
+	if err := path.Parse(expression); err != nil {
+		return nil, fmt.Errorf(`Invalid JSONPath "%v": %w`, expression, err)
+	}
+	return path, nil
+}
+
+// parsePerfFromJSON splits a "label=jsonpath" performance data mapping.
+func parsePerfFromJSON(perfFromJSON string) (string, *jsonpath.JSONPath, error) {
+	kv := strings.SplitN(perfFromJSON, "=", 2)
+	if len(kv) != 2 || kv[0] == "" {
+		return "", nil, fmt.Errorf(`Invalid JSON performance data "%v" [Format: 'label=$.jsonpath']`, perfFromJSON)
+	}
+	path, err := parseJSONPath(kv[1])
+	return kv[0], path, err
+}
+
+// jsonPerfData extracts performance data from the command JSON stdout.
+// Missing or non numeric values are omitted.
+func jsonPerfData(req *Request, stdout string) ([]string, error) {
+	if len(req.PerfFromJSON) == 0 {
+		return nil, nil
+	}
+
+	var data interface{}
+	if err := json.Unmarshal([]byte(stdout), &data); err != nil {
+		log.Printf("No JSON performance data, output is not valid JSON: %v", err)
+		return nil, nil
+	}
+
+	var perfData []string
+	for _, perfFromJSON := range req.PerfFromJSON {
+		label, path, err := parsePerfFromJSON(perfFromJSON)
+		if err != nil {
+			return nil, err
+		}
+		var value bytes.Buffer
+		if err := path.Execute(&value, data); err != nil {
+			log.Printf(`No performance data "%v": %v`, label, err)
+			continue
+		}
+		if _, err := strconv.ParseFloat(value.String(), 64); err != nil {
+			log.Printf(`No performance data "%v": "%v" is not a number`, label, value.String())
+			continue
+		}
+		perfData = append(perfData, fmt.Sprintf("%v=%v", label, value.String()))
+	}
+	return perfData, nil
+}
+
+// decompressOutput decompresses the command stdout with the given format,
+// only gzip being supported.
+func decompressOutput(format, stdout string) (string, error) {
+	if format != "gzip" {
+		return "", fmt.Errorf(`Unsupported decompression format "%v"`, format)
+	}
+	reader, err := gzip.NewReader(strings.NewReader(stdout))
+	if err != nil {
+		return "", err
+	}
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// validateExpectations parses the output expectations so that an invalid one
+// is reported before connecting to the cluster.
+func validateExpectations(req *Request) error {
+	if req.Decompress != "" && req.Decompress != "gzip" {
+		return fmt.Errorf(`Unsupported decompression format "%v"`, req.Decompress)
+	}
+	if req.MatchMode != "" && req.MatchMode != "all" && req.MatchMode != "any" {
+		return fmt.Errorf(`Unsupported match mode "%v"`, req.MatchMode)
+	}
+	if req.MismatchRetries < 0 {
+		return fmt.Errorf("Output mismatch retries must not be negative")
+	}
+	if req.MismatchRetries > 0 && req.MismatchBackoff <= 0 {
+		return fmt.Errorf("Retry backoff must be positive")
+	}
+	for _, normalization := range req.NormalizeOutput {
+		if _, ok := outputNormalizations[normalization]; !ok {
+			return fmt.Errorf(`Unsupported output normalization "%v"`, normalization)
+		}
+	}
+	for _, expectOutput := range req.ExpectOutput {
+		if _, err := regexp.Compile(expectOutput); err != nil {
+			return fmt.Errorf(`Invalid output regular expression "%v": %w`, expectOutput, err)
+		}
+	}
+	if req.ExpectJSONPath != "" {
+		if _, _, _, err := parseExpectJSONPath(req.ExpectJSONPath); err != nil {
+			return err
+		}
+	}
+	for _, perfFromJSON := range req.PerfFromJSON {
+		if _, _, err := parsePerfFromJSON(perfFromJSON); err != nil {
+			return err
+		}
+	}
+	if req.IgnoreExitCode {
+		if len(req.ExpectOutput) == 0 && req.ExpectJSONPath == "" {
+			return fmt.Errorf("Ignore exit code requires an expected output or JSONPath")
+		}
+		if req.StatusMapFile != "" || req.StatusFromOutput {
+			return fmt.Errorf("Ignore exit code is mutually exclusive with status map file and status from output")
+		}
+	}
+	if req.StatusMapFile != "" {
+		if _, err := readStatusMap(req.StatusMapFile); err != nil {
+			return err
+		}
+	}
+	for _, limit := range []string{req.ExpectCPULimit, req.ExpectMemoryLimit} {
+		if limit == "" {
+			continue
+		}
+		if _, err := resource.ParseQuantity(limit); err != nil {
+			return fmt.Errorf(`Invalid resource limit "%v": %w`, limit, err)
+		}
+	}
+	return nil
+}
+
+// outputNormalizations are the normalizations of the command stdout which
+// may be applied before matching it against the output regular expressions.
+var outputNormalizations = map[string]func(string) string{
+	// trim removes the leading and trailing whitespace, such as the final
+	// newline
+	"trim": strings.TrimSpace,
+	// lowercase converts the output to lower case, the expressions being
+	// left as is
+	"lowercase": strings.ToLower,
+	// collapse-space replaces each run of whitespace, including newlines,
+	// by a single space
+	"collapse-space": func(s string) string {
+		return whitespace.ReplaceAllString(s, " ")
+	},
+}
+
+var whitespace = regexp.MustCompile(`\s+`)
+
+// normalizeOutput applies the normalizations to the stdout, always in the
+// order collapse-space, trim, lowercase whatever their order in the flag.
+func normalizeOutput(req *Request, stdout string) string {
+	for _, name := range []string{"collapse-space", "trim", "lowercase"} {
+		for _, normalization := range req.NormalizeOutput {
+			if normalization == name {
+				stdout = outputNormalizations[name](stdout)
+			}
+		}
+	}
+	return stdout
+}
+
+// matchOutput matches the command stdout against the output regular
+// expressions, once normalized: all of them must match, or any one with the
+// "any" match mode.
+// The mismatch description lists the expressions which did and did not match.
+func matchOutput(req *Request, stdout string) (string, error) {
+	stdout = normalizeOutput(req, stdout)
+	var matched, failed []string
+	for _, expectOutput := range req.ExpectOutput {
+		re, err := regexp.Compile(expectOutput)
+		if err != nil {
+			return "", fmt.Errorf(`Invalid output regular expression "%v": %w`, expectOutput, err)
+		}
+		if re.MatchString(stdout) {
+			matched = append(matched, `"`+expectOutput+`"`)
+		} else {
+			failed = append(failed, `"`+expectOutput+`"`)
+		}
+	}
+
+	if len(failed) == 0 || (req.MatchMode == "any" && len(matched) > 0) {
+		return "", nil
+	}
+	if len(req.ExpectOutput) == 1 {
+		return fmt.Sprintf(`output does not match "%v"`, req.ExpectOutput[0]), nil
+	}
+	if req.MatchMode == "any" {
+		return fmt.Sprintf("output matches none of %v", strings.Join(failed, ", ")), nil
+	}
+	if len(matched) == 0 {
+		return fmt.Sprintf("output does not match %v", strings.Join(failed, ", ")), nil
+	}
+	return fmt.Sprintf("output does not match %v, matches %v", strings.Join(failed, ", "), strings.Join(matched, ", ")), nil
+}
+
+// checkOutput returns a description of the first output expectation not met
+// by the command stdout, or an empty string if all of them are met.
+func checkOutput(req *Request, stdout string) (string, error) {
+	if len(req.ExpectOutput) > 0 {
+		mismatch, err := matchOutput(req, stdout)
+		if err != nil || mismatch != "" {
+			return mismatch, err
+		}
+	}
+
+	if req.ExpectJSONPath != "" {
+		path, value, hasValue, err := parseExpectJSONPath(req.ExpectJSONPath)
+		if err != nil {
+			return "", err
+		}
+		var data interface{}
+		if err := json.Unmarshal([]byte(stdout), &data); err != nil {
+			return fmt.Sprintf("output is not valid JSON: %v", err), nil
+		}
+		var found bytes.Buffer
+		if err := path.Execute(&found, data); err != nil {
+			return fmt.Sprintf(`output does not match JSONPath "%v": %v`, req.ExpectJSONPath, err), nil
+		}
+		if hasValue && found.String() != value {
+			return fmt.Sprintf(`output JSONPath value "%v" is not "%v"`, found.String(), value), nil
+		}
+	}
+
+	return "", nil
+}
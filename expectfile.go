@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+)
+
+// expectFileTests maps the expected file types to the test operator checking
+// that a file of this type exists.
+var expectFileTests = map[string]string{
+	"any":     "-e",
+	"file":    "-f",
+	"dir":     "-d",
+	"socket":  "-S",
+	"symlink": "-L",
+}
+
+// expectFileCommand returns the command vector checking that the file exists
+// with the expected type.
+func expectFileCommand(path, fileType string) ([]string, error) {
+	operator, ok := expectFileTests[fileType]
+	if !ok {
+		return nil, fmt.Errorf(`Unsupported expected file type "%v"`, fileType)
+	}
+	return []string{"test", operator, path}, nil
+}
+
+// expectFileDiagnosis describes the failure of the expected file test.
+func expectFileDiagnosis(req *Request) string {
+	if req.ExpectFileType == "any" {
+		return fmt.Sprintf(`"%v" does not exist`, req.ExpectFile)
+	}
+	return fmt.Sprintf(`"%v" is not an existing %v`, req.ExpectFile, req.ExpectFileType)
+}
@@ -0,0 +1,47 @@
+package main
+
+// Extra headers are added to every API request by wrapping the transport of
+// the client config. The SPDY round tripper used by exec is built from the
+// same config, so the headers are also sent with the exec upgrade request,
+// but not with the CONNECT request issued when going through an HTTP proxy.
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"k8s.io/client-go/rest"
+)
+
+type headerRoundTripper struct {
+	headers http.Header
+	rt      http.RoundTripper
+}
+
+func (h *headerRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for key, values := range h.headers {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	return h.rt.RoundTrip(req)
+}
+
+// addHeaders wraps the transport of config to send the headers, given as
+// "KEY:VALUE", with each request.
+func addHeaders(config *rest.Config, headers []string) error {
+	parsed := http.Header{}
+	for _, header := range headers {
+		kv := strings.SplitN(header, ":", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return fmt.Errorf(`Invalid header "%v" [Format: 'KEY:VALUE']`, header)
+		}
+		parsed.Add(strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1]))
+	}
+
+	config.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return &headerRoundTripper{headers: parsed, rt: rt}
+	})
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+)
+
+// parseHTTPGet splits the HTTP GET target into its path and port.
+func parseHTTPGet(target string) (string, int, error) {
+	i := strings.LastIndex(target, ":")
+	if i < 0 || !strings.HasPrefix(target, "/") {
+		return "", 0, fmt.Errorf(`Invalid HTTP GET "%v" [Format: '/path:port']`, target)
+	}
+	port, err := strconv.Atoi(target[i+1:])
+	if err != nil || port < 1 || port > 65535 {
+		return "", 0, fmt.Errorf(`Invalid HTTP GET port in "%v" [Format: '/path:port']`, target)
+	}
+	return target[:i], port, nil
+}
+
+// checkHTTPGet sends an HTTP GET to the pod port through a port-forward, for
+// the containers without any shell or tool to exec. As for a kubelet HTTP
+// probe, the check passes if the HTTP status code is 2xx or 3xx. Redirects are
+// not followed, the first response being judged, as a redirect would leave the
+// port-forward.
+func checkHTTPGet(ctx context.Context, config *rest.Config, kubeClient *kubernetes.Clientset, req *Request, pod *corev1.Pod) (string, interface{}) {
+	path, port, err := parseHTTPGet(req.HTTPGet)
+	if err != nil {
+		return "UNKNOWN", err
+	}
+
+	transport, upgrader, err := spdy.RoundTripperFor(config)
+	if err != nil {
+		return "UNKNOWN", fmt.Errorf("Failed to create port-forward transport: %w", err)
+	}
+	url := kubeClient.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(req.Namespace).
+		Name(pod.Name).
+		SubResource("portforward").
+		URL()
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, "POST", url)
+
+	stop, ready := make(chan struct{}), make(chan struct{})
+	defer close(stop)
+	forwarder, err := portforward.NewOnAddresses(dialer, []string{"127.0.0.1"}, []string{fmt.Sprintf("0:%v", port)},
+		stop, ready, ioutil.Discard, ioutil.Discard)
+	if err != nil {
+		return "UNKNOWN", fmt.Errorf("Failed to create port-forward: %w", err)
+	}
+	errs := make(chan error, 1)
+	go func() { errs <- forwarder.ForwardPorts() }()
+	select {
+	case <-ready:
+	case err := <-errs:
+		return "UNKNOWN", fmt.Errorf("Port-forward to port %v failed: %w", port, err)
+	case <-ctx.Done():
+		return "UNKNOWN", fmt.Errorf("Port-forward to port %v failed: %w", port, ctx.Err())
+	}
+	ports, err := forwarder.GetPorts()
+	if err != nil || len(ports) == 0 {
+		return "UNKNOWN", fmt.Errorf("Port-forward to port %v failed: no local port", port)
+	}
+
+	start := time.Now()
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://127.0.0.1:%v%v", ports[0].Local, path), nil)
+	if err != nil {
+		return "UNKNOWN", fmt.Errorf("[config] Invalid HTTP GET: %w", err)
+	}
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		Timeout:       req.Timeout,
+	}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return "UNKNOWN", fmt.Errorf("HTTP GET %v on port %v failed: %w", path, port, err)
+	}
+	resp.Body.Close()
+	elapsed := time.Since(start)
+
+	ok := resp.StatusCode >= 200 && resp.StatusCode < 400
+	status, message := evaluate(ok, fmt.Sprintf("HTTP GET %v on port %v returned %v", path, port, resp.Status))
+	return status, fmt.Sprintf("%v | http_code=%v http_time=%.3fs", message, resp.StatusCode, elapsed.Seconds())
+}
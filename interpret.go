@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// exitCodeMeanings maps the exit codes of well-known commands, keyed by
+// command basename, to human readable meanings.
+var exitCodeMeanings = map[string]map[int]string{
+	"curl": {
+		6:  "couldn't resolve host",
+		7:  "couldn't connect",
+		22: "HTTP error",
+		28: "timeout",
+		35: "SSL connect error",
+		52: "empty reply from server",
+		56: "failure receiving network data",
+		60: "peer certificate cannot be authenticated",
+	},
+	"wget": {
+		1: "generic error",
+		2: "parse error",
+		3: "file I/O error",
+		4: "network failure",
+		5: "SSL verification failure",
+		6: "authentication failure",
+		7: "protocol error",
+		8: "server error response",
+	},
+	"grep": {
+		1: "no line selected",
+		2: "error",
+	},
+	"pg_isready": {
+		1: "server rejecting connections",
+		2: "no response",
+		3: "no attempt made",
+	},
+	"redis-cli": {
+		1: "error",
+	},
+	"timeout": {
+		124: "timeout",
+	},
+}
+
+// commandBasename returns the basename of the command run by the check, which
+// is the first word of the arguments when the command is a shell.
+func commandBasename(req *Request) string {
+	return path.Base(commandPath(req))
+}
+
+// commandPath returns the command run by the check, the first word of the
+// arguments when the command is a shell.
+func commandPath(req *Request) string {
+	if shells[path.Base(req.Command)] {
+		if words := strings.Fields(req.Arg); len(words) > 0 {
+			return words[0]
+		}
+	}
+	return req.Command
+}
+
+// diagnoseExitCode explains the exit codes of the shell, or of the container
+// runtime, meaning that the command could not be run at all, which usually is
+// a misconfiguration of the check, as well as the failure of the expected
+// file test. It returns an empty string for the other exit codes.
+func diagnoseExitCode(req *Request, exitCode int) string {
+	if req.ExpectFile != "" && exitCode == 1 {
+		return expectFileDiagnosis(req)
+	}
+	switch exitCode {
+	case 126:
+		return fmt.Sprintf("command not executable (126): is %v executable by the container user?", commandPath(req))
+	case 127:
+		return fmt.Sprintf("command not found (127): is %v present in the image?", commandPath(req))
+	}
+	return ""
+}
+
+// interpretExitCode returns the meaning of the exit code of the command, or
+// an empty string if it is unknown.
+func interpretExitCode(req *Request, exitCode int) string {
+	name := commandBasename(req)
+	if meaning, ok := exitCodeMeanings[name][exitCode]; ok {
+		return name + ": " + meaning
+	}
+	return ""
+}
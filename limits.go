@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// auditsLimits reports whether the check audits the container resource
+// limits instead of running exec.
+func (req *Request) auditsLimits() bool {
+	return req.ExpectCPULimit != "" || req.ExpectMemoryLimit != ""
+}
+
+// checkLimits audits, from the pod spec and without running exec, that the
+// container CPU and memory limits are the expected quantities. It warns about
+// a missing or changed limit.
+func checkLimits(container *corev1.Container, req *Request) (string, interface{}) {
+	limits := []struct {
+		name   corev1.ResourceName
+		expect string
+	}{
+		{corev1.ResourceCPU, req.ExpectCPULimit},
+		{corev1.ResourceMemory, req.ExpectMemoryLimit},
+	}
+
+	var found, mismatches []string
+	for _, l := range limits {
+		if l.expect == "" {
+			continue
+		}
+		expect, err := resource.ParseQuantity(l.expect)
+		if err != nil {
+			return "UNKNOWN", fmt.Errorf(`Invalid %v limit "%v": %w`, l.name, l.expect, err)
+		}
+		actual, ok := container.Resources.Limits[l.name]
+		switch {
+		case !ok:
+			mismatches = append(mismatches, fmt.Sprintf(`no %v limit, expected "%v"`, l.name, expect.String()))
+		case actual.Cmp(expect) != 0:
+			mismatches = append(mismatches, fmt.Sprintf(`%v limit "%v" is not "%v"`, l.name, actual.String(), expect.String()))
+		default:
+			found = append(found, fmt.Sprintf(`%v limit "%v"`, l.name, actual.String()))
+		}
+	}
+
+	if len(mismatches) > 0 {
+		return "1", fmt.Sprintf(`Container "%v" limits changed: %v`, container.Name, strings.Join(mismatches, ", "))
+	}
+	return "0", fmt.Sprintf(`Container "%v" has %v`, container.Name, strings.Join(found, ", "))
+}
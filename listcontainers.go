@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// containerInfo describes a container of a pod, to find the value of the
+// container flag.
+type containerInfo struct {
+	Pod   string `json:"pod"`
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Image string `json:"image"`
+	State string `json:"state"`
+}
+
+func (c containerInfo) String() string {
+	return fmt.Sprintf("%v\t%v\t%v\t%v\t%v", c.Pod, c.Name, c.Type, c.Image, c.State)
+}
+
+// containerState summarizes the state of a container status, as
+// kubectl get pods does.
+func containerState(status *corev1.ContainerStatus) string {
+	switch {
+	case status == nil:
+		return "unknown"
+	case status.State.Running != nil:
+		return "running"
+	case status.State.Waiting != nil:
+		return fmt.Sprintf("waiting (%v)", status.State.Waiting.Reason)
+	case status.State.Terminated != nil:
+		return fmt.Sprintf("terminated (%v, exit %v)", status.State.Terminated.Reason, status.State.Terminated.ExitCode)
+	}
+	return "unknown"
+}
+
+func findContainerStatus(statuses []corev1.ContainerStatus, name string) *corev1.ContainerStatus {
+	for i := range statuses {
+		if statuses[i].Name == name {
+			return &statuses[i]
+		}
+	}
+	return nil
+}
+
+// podContainers lists the regular, init and ephemeral containers of the pod.
+func podContainers(pod *corev1.Pod) []containerInfo {
+	var containers []containerInfo
+	add := func(kind string, container corev1.Container, statuses []corev1.ContainerStatus) {
+		containers = append(containers, containerInfo{
+			Pod:   pod.Name,
+			Name:  container.Name,
+			Type:  kind,
+			Image: container.Image,
+			State: containerState(findContainerStatus(statuses, container.Name)),
+		})
+	}
+	for _, container := range pod.Spec.InitContainers {
+		add("init", container, pod.Status.InitContainerStatuses)
+	}
+	for _, container := range pod.Spec.Containers {
+		add("regular", container, pod.Status.ContainerStatuses)
+	}
+	for _, container := range pod.Spec.EphemeralContainers {
+		add("ephemeral", corev1.Container(container.EphemeralContainerCommon), pod.Status.EphemeralContainerStatuses)
+	}
+	return containers
+}
+
+// listContainers fetches the pods as the check does and lists their
+// containers.
+func listContainers(ctx context.Context, req *Request) ([]containerInfo, error) {
+	if err := resolveNamespace(req); err != nil {
+		return nil, fmt.Errorf("[config] %w", err)
+	}
+	_, kubeClient, err := req.connect()
+	if err != nil {
+		return nil, err
+	}
+	if req.Deployment != "" {
+		if _, err := resolveDeployment(ctx, kubeClient, req); err != nil {
+			return nil, err
+		}
+	}
+	if req.ReplicaSet != "" {
+		if _, err := resolveReplicaSet(ctx, kubeClient, req); err != nil {
+			return nil, err
+		}
+	}
+	pods, err := getPods(ctx, kubeClient, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var containers []containerInfo
+	for _, pod := range pods {
+		containers = append(containers, podContainers(pod)...)
+	}
+	return containers, nil
+}
+
+// newListContainersCmd returns the list-containers subcommand, which shares
+// the flags of the check command to select the pods.
+func newListContainersCmd(check *cobra.Command, req *Request) *cobra.Command {
+	c := &cobra.Command{
+		Use:   "list-containers",
+		Short: "List the names, images and states of the containers of the pod, to find the container to check",
+
+		PreRunE: check.PreRunE,
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx, cancel := runContext(req)
+			containers, err := listContainers(ctx, req)
+			cancel()
+			if err != nil {
+				log.Fatalf("%v", err)
+			}
+
+			if req.outputFormat == "json" {
+				data, err := json.Marshal(containers)
+				if err != nil {
+					log.Fatalf("Failed to format containers: %v", err)
+				}
+				fmt.Println(string(data))
+				return
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+			fmt.Fprintln(w, "POD\tNAME\tTYPE\tIMAGE\tSTATE")
+			for _, container := range containers {
+				fmt.Fprintln(w, container)
+			}
+			w.Flush()
+		},
+	}
+
+	c.Flags().AddFlagSet(check.Flags())
+	return c
+}
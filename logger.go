@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// jsonLogWriter formats the lines of the standard logger as JSON objects,
+// with the fields describing the current step of the check.
+type jsonLogWriter struct {
+	mu     sync.Mutex
+	out    io.Writer
+	fields map[string]string
+}
+
+var jsonLog *jsonLogWriter
+
+func (w *jsonLogWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	entry := map[string]string{
+		"time": time.Now().Format(time.RFC3339Nano),
+		"msg":  strings.TrimSuffix(string(p), "\n"),
+	}
+	for key, value := range w.fields {
+		entry[key] = value
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := w.out.Write(append(data, '\n')); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// setLogFormat sets the format of the diagnostic logs, text or json. It does
+// not change the check output.
+func setLogFormat(format string) error {
+	switch format {
+	case "text":
+		return nil
+	case "json":
+		jsonLog = &jsonLogWriter{out: os.Stderr, fields: map[string]string{}}
+		log.SetFlags(0)
+		log.SetOutput(jsonLog)
+		return nil
+	default:
+		return fmt.Errorf(`Unsupported log format "%v"`, format)
+	}
+}
+
+// setLogField sets a field added to the following JSON log lines, such as the
+// pod, the container or the step of the check. An empty value removes it.
+func setLogField(key, value string) {
+	if jsonLog == nil {
+		return
+	}
+	jsonLog.mu.Lock()
+	defer jsonLog.mu.Unlock()
+	if value == "" {
+		delete(jsonLog.fields, key)
+		return
+	}
+	jsonLog.fields[key] = value
+}
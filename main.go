@@ -1,145 +1,1587 @@
 package main
 
-// Test with: "kubectl run --generator=run-pod/v1 shell --rm -it --image ubuntu -- bash"
+// Test with: "checkexec setup-test-pod", which creates the pod that
+// "kubectl run --generator=run-pod/v1 shell --rm -it --image ubuntu -- bash" did
 // See: https://github.com/kubernetes/kubernetes/blob/master/test/e2e/framework/exec_util.go
 
 import (
+	"context"
+	"crypto/x509"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
+	"os/signal"
+	"path"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode/utf8"
 
 	"github.com/spf13/cobra"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"go.opentelemetry.io/otel/attribute"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/tools/remotecommand"
 	utilexec "k8s.io/client-go/util/exec"
 )
 
+// version is set at build time by the Makefile.
+var version = "dev"
+
+// Writer is safe for concurrent use, so that it can capture both stdout and
+// stderr. The chunks written are timestamped into rate if it is set.
 type Writer struct {
-	Str []string
+	Str  []string
+	mu   sync.Mutex
+	rate *outputRate
 }
 
 func (w *Writer) Write(p []byte) (n int, err error) {
 	str := string(p)
 	if len(str) > 0 {
+		w.mu.Lock()
 		w.Str = append(w.Str, str)
+		if w.rate != nil {
+			w.rate.add(len(str), time.Now())
+		}
+		w.mu.Unlock()
 	}
 	return len(str), nil
 }
 
-func newStringReader(ss []string) io.Reader {
-	formattedString := strings.Join(ss, "\n")
+func (w *Writer) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return strings.Join(w.Str, "")
+}
+
+func newStringReader(ss []string, separator string) io.Reader {
+	formattedString := strings.Join(ss, separator)
 	reader := strings.NewReader(formattedString)
 	return reader
 }
 
-func CheckKubeExec(req *Request) (string, interface{}) {
-	config, err := clientcmd.BuildConfigFromFlags(req.masterURL, req.kubeconfigPath)
+// openReader reads the content of its reader, then blocks instead of
+// returning EOF until ctx is done, keeping the stdin stream of the exec open.
+type openReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (r *openReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if err != io.EOF {
+		return n, err
+	}
+	if n > 0 {
+		return n, nil
+	}
+	<-r.ctx.Done()
+	return 0, io.EOF
+}
+
+// Timings holds the duration of each phase of a check.
+type Timings struct {
+	Config time.Duration
+	PodGet time.Duration
+	Exec   time.Duration
+}
+
+// PerfData formats the timings as Nagios performance data.
+func (t Timings) PerfData() string {
+	return fmt.Sprintf("config_time=%.3fs pod_get_time=%.3fs exec_time=%.3fs",
+		t.Config.Seconds(), t.PodGet.Seconds(), t.Exec.Seconds())
+}
+
+// CheckKubeExec runs the check described by req and returns its result. When
+// the check cannot be performed, the status is UNKNOWN and the result error
+// wraps the cause. The API requests and the exec are aborted once ctx is done.
+func CheckKubeExec(ctx context.Context, req *Request) *Result {
+	req.budget = newRetryBudget(req.RetryBudget)
+	check := checkKubeExec
+	if len(req.Namespaces) > 0 {
+		check = checkNamespaces
+	}
+	var result *Result
+	if req.breakerThreshold > 0 {
+		result = traceCheck(ctx, req, func(ctx context.Context, req *Request) *Result {
+			return checkWithBreaker(ctx, req, check)
+		})
+	} else {
+		result = traceCheck(ctx, req, check)
+	}
+	recordResult(req, result)
+	return result
+}
+
+// recordResult writes the results of the check to the textfile and the audit
+// file, whichever step it ended at, so that the metrics of a check which
+// cannot be performed are UNKNOWN rather than stale, and that its attempt is
+// audited.
+func recordResult(req *Request, result *Result) {
+	if req.textfileOutput != "" {
+		writeTextfile(req, result.records())
+	}
+	if req.auditFile != "" {
+		writeAudit(auditConfig(req), req, result.records())
+	}
+}
+
+func checkKubeExec(ctx context.Context, req *Request) *Result {
+	var timings Timings
+	setLogField("step", "config")
+
+	if err := resolveNamespace(req); err != nil {
+		return errorResult(req, fmt.Errorf("[config] %w", err))
+	}
+
+	if req.allowedCommandsFile != "" && req.ExpectLabel == "" && req.FreshAnnotation == "" && req.ProbeType == "" && req.HTTPGet == "" && !req.auditsProbes() && !req.auditsLimits() {
+		if err := checkAllowedCommand(req); err != nil {
+			return errorResult(req, err)
+		}
+	}
+
+	start := time.Now()
+	_, span := startSpan(ctx, "config")
+	config, kubeClient, err := req.connect()
+	endSpan(span, err)
 	if err != nil {
-		return "UNKNOWN", err
+		return errorResult(req, err)
 	}
-	kubeClient := kubernetes.NewForConfigOrDie(config)
+	timings.Config = time.Since(start)
 
-	pod, err := kubeClient.CoreV1().Pods(req.Namespace).Get(req.Pod, metav1.GetOptions{})
+	setLogField("step", "pod-get")
+	start = time.Now()
+	podCtx, span := startSpan(ctx, "pod-get")
+	if req.CheckNamespace {
+		if err := checkNamespaceExists(podCtx, kubeClient, req); err != nil {
+			endSpan(span, err)
+			return errorResult(req, err)
+		}
+	}
+	if req.Deployment != "" {
+		deployment, err := resolveDeployment(podCtx, kubeClient, req)
+		if err != nil {
+			endSpan(span, err)
+			return errorResult(req, err)
+		}
+		if req.RequireRolloutComplete {
+			if status, message := checkRollout(deployment); status != "0" {
+				endSpan(span, nil)
+				return &Result{Status: status, ExitCode: -1, Namespace: req.Namespace, Message: message, Reason: "assertion"}
+			}
+		}
+	}
+	revision := ""
+	if req.ReplicaSet != "" {
+		rs, err := resolveReplicaSet(podCtx, kubeClient, req)
+		if err != nil {
+			endSpan(span, err)
+			return errorResult(req, err)
+		}
+		revision = replicaSetRevision(rs)
+	}
+	pods, err := getPods(podCtx, kubeClient, req)
+	endSpan(span, err)
 	if err != nil {
-		return "UNKNOWN", err
+		return errorResult(req, err)
+	}
+	timings.PodGet = time.Since(start)
+
+	if req.AllPods {
+		aggregate := checkPods
+		if req.ComparePods {
+			aggregate = comparePods
+		}
+		result := aggregate(ctx, config, kubeClient, req, pods, timings)
+		if revision != "" {
+			*result = appendOutput(*result, revision)
+		}
+		return result
+	}
+	check := checkPod
+	if req.Count > 1 {
+		check = checkPodCount
+	}
+	result := check(ctx, config, kubeClient, req, pods[0], timings)
+
+	// during a rollout, the pod matching the selector may be deleted
+	// between the list and the exec
+	if req.Selector != "" && result.Status == "UNKNOWN" && isNotFound(result.Err) {
+		if err := req.budget.allow(); err != nil {
+			return errorResult(req, fmt.Errorf(`%w, pod "%v" deleted during check`, err, pods[0].Name))
+		}
+		log.Printf(`Pod "%v" deleted during check, retrying with another pod`, pods[0].Name)
+		start = time.Now()
+		pods, err = getPodsBySelector(ctx, kubeClient, req, pods[0].Name)
+		if err != nil {
+			return errorResult(req, err)
+		}
+		timings.PodGet += time.Since(start)
+		result = check(ctx, config, kubeClient, req, pods[0], timings)
+		req.budget.spend(time.Since(start))
+	}
+
+	if req.TolerateNotReady && pods[0].Status.Phase == corev1.PodRunning && !isPodReady(pods[0]) {
+		result = tolerateNotReady(pods[0], result)
+	}
+	if req.ShowEvents && result.Status != "0" {
+		result = addEvents(ctx, kubeClient, req, result)
+	}
+	if req.ShowPDB {
+		result = addPDB(ctx, kubeClient, pods[0], result)
+	}
+	if revision != "" {
+		result = appendOutput(result, revision)
+	}
+	if req.EmitEvent && result.Status != "0" {
+		emitEvent(ctx, kubeClient, pods[0], result)
+	}
+
+	return &result
+}
+
+// sharedClient is a client to the API server built once and reused by the
+// checks of a request run repeatedly, which saves loading the client config
+// and the TLS handshakes of each check.
+type sharedClient struct {
+	config     *rest.Config
+	kubeClient *kubernetes.Clientset
+}
+
+// shareClient builds the client which the following checks of the request
+// reuse.
+func (req *Request) shareClient() error {
+	config, kubeClient, err := newClient(req)
+	if err != nil {
+		return err
+	}
+	req.client = &sharedClient{config: config, kubeClient: kubeClient}
+	return nil
+}
+
+// connect returns the shared client of the request, or else a new one.
+func (req *Request) connect() (*rest.Config, *kubernetes.Clientset, error) {
+	if req.client != nil {
+		return req.client.config, req.client.kubeClient, nil
+	}
+	return newClient(req)
+}
+
+// loadClientConfig loads the client config as kubectl does: from the
+// kubeconfig file, else the KUBECONFIG files or ~/.kube/config, else the
+// in-cluster config. Credential plugins, such as "aws eks get-token", are run
+// non-interactively to get the credentials.
+func loadClientConfig(req *Request) (*rest.Config, error) {
+	return kubeconfig(req).ClientConfig()
+}
+
+func kubeconfig(req *Request) clientcmd.ClientConfig {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = req.kubeconfigPath
+	overrides := &clientcmd.ConfigOverrides{}
+	overrides.ClusterInfo.Server = req.masterURL
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides)
+}
+
+// newClient builds the client config from the flags and creates the client.
+func newClient(req *Request) (*rest.Config, *kubernetes.Clientset, error) {
+	config, err := loadClientConfig(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("[config] Failed to build client config: %w", err)
+	}
+
+	if req.caFile != "" {
+		if err := checkCAFile(req.caFile); err != nil {
+			return nil, nil, fmt.Errorf("[config] %w", err)
+		}
+		config.TLSClientConfig.CAFile = req.caFile
+		config.TLSClientConfig.CAData = nil
+	}
+
+	if req.tokenFile != "" {
+		if _, err := ioutil.ReadFile(req.tokenFile); err != nil {
+			return nil, nil, fmt.Errorf("[config] Failed to read service account token file: %w", err)
+		}
+		// client-go re-reads the file periodically, which handles the
+		// rotation of projected service account tokens
+		config.BearerTokenFile = req.tokenFile
+		config.BearerToken = ""
+	}
+
+	// the API server audit logs attribute the requests to the checks
+	config.UserAgent = req.userAgent
+	if config.UserAgent == "" {
+		config.UserAgent = "checkexec/" + version
+	}
+
+	if len(req.headers) > 0 {
+		if err := addHeaders(config, req.headers); err != nil {
+			return nil, nil, fmt.Errorf("[config] %w", err)
+		}
+	}
+
+	if req.trace {
+		addTracePropagation(config)
+	}
+
+	kubeClient, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("[config] Failed to create client: %w", err)
+	}
+	return config, kubeClient, nil
+}
+
+// checkPod runs the check against the pod.
+func checkPod(ctx context.Context, config *rest.Config, kubeClient *kubernetes.Clientset, req *Request, pod *corev1.Pod, timings Timings) Result {
+	setLogField("pod", pod.Name)
+	setLogField("container", "")
+	setLogField("step", "precondition")
+	result := Result{Pod: pod.Name, Container: req.Container, Namespace: req.Namespace, ExitCode: -1}
+	done := func(status string, output interface{}) Result {
+		result.Status = status
+		result.setOutput(output)
+		result.Duration = timings.Config + timings.PodGet + timings.Exec
+		result.Timings = timings
+		return result
+	}
+	if req.dumpPod {
+		dumpPod(pod)
+	}
+
+	if pod.DeletionTimestamp != nil {
+		result.Reason = "not-running"
+		return done(checkPodTerminating(pod, req.TerminatingStatus))
+	}
+
+	if len(req.AllowedPhases) > 0 {
+		if status, output, running := checkPodPhase(pod, req); !running {
+			result.Reason = "not-running"
+			return done(status, output)
+		}
 	}
 
-	if req.Container != "" {
-		notFound := true
-		for _, container := range pod.Spec.Containers {
-			if container.Name == req.Container {
-				notFound = false
+	for _, condition := range req.RequireConditions {
+		if status, output := checkPodCondition(pod, condition); status != "0" {
+			return done(status, output)
+		}
+	}
+
+	if req.MinPodAge > 0 || req.MaxPodAge > 0 {
+		if status, output := checkPodAge(pod, req.MinPodAge, req.MaxPodAge); status != "0" {
+			return done(status, output)
+		}
+	}
+
+	if req.ExpectLabel != "" {
+		return done(checkPodLabel(pod, req.ExpectLabel))
+	}
+
+	if req.FreshAnnotation != "" {
+		return done(checkAnnotationFreshness(pod, req.FreshAnnotation, req.MaxStaleness))
+	}
+
+	if req.HTTPGet != "" {
+		return done(checkHTTPGet(ctx, config, kubeClient, req, pod))
+	}
+
+	if req.WaitSidecar != "" {
+		if err := waitSidecar(ctx, kubeClient, req, pod); err != nil {
+			return done("UNKNOWN", err)
+		}
+	}
+
+	name := req.Container
+	if req.Container == "" && req.ContainerIndex >= 0 {
+		if req.ContainerIndex >= len(pod.Spec.Containers) {
+			return done(outputStatuses[req.MissingContainerStatus], withReason("not-found", fmt.Errorf(`Container index %v out of range, pod "%v" has %v containers: %v`,
+				req.ContainerIndex, pod.Name, len(pod.Spec.Containers), containerNames(pod))))
+		}
+		name = pod.Spec.Containers[req.ContainerIndex].Name
+		log.Printf(`Container %v is "%v"`, req.ContainerIndex, name)
+	}
+
+	containers := []string{name}
+	if len(req.ContainerFallback) > 0 {
+		if name == "" {
+			containers = req.ContainerFallback
+		} else {
+			containers = append(containers, req.ContainerFallback...)
+		}
+	}
+	if req.Logic != "" && len(containers) > 1 {
+		return checkContainers(ctx, config, kubeClient, req, pod, containers, timings)
+	}
+
+	templated := isCommandTemplate(req)
+	req, err := renderCommand(req, pod)
+	if err != nil {
+		return done("UNKNOWN", err)
+	}
+	if req.allowedCommandsFile != "" && templated {
+		// the rendered pod metadata must not smuggle in other commands
+		if err := checkAllowedCommand(req); err != nil {
+			return done("UNKNOWN", err)
+		}
+	}
+
+	execReq := req
+	if req.OS != "linux" && shells[path.Base(req.Command)] {
+		podOS := req.OS
+		if podOS == "auto" || podOS == "node" {
+			podOS = detectOS(ctx, kubeClient, pod, podOS == "node")
+			log.Printf(`Pod "%v" runs on %v`, pod.Name, podOS)
+		}
+		if podOS == "windows" {
+			windowsReq := *req
+			windowsReq.Command = windowsShell
+			execReq = &windowsReq
+		}
+	}
+
+	var status string
+	var output interface{}
+containers:
+	for _, name := range containers {
+		setLogField("container", name)
+		container := getContainer(pod, name)
+		if container == nil {
+			status = outputStatuses[req.MissingContainerStatus]
+			output = withReason("not-found", fmt.Errorf(`Container "%v" not found, pod "%v" has containers: %v`, name, pod.Name, containerNames(pod)))
+			log.Print(output)
+			continue
+		}
+
+		log.Printf(`Container "%v" found`, name)
+		result.Container = container.Name
+
+		if req.RunAsUID >= 0 {
+			if status, output = checkRunAsUser(pod, container, req.RunAsUID); status != "0" {
+				return done(status, output)
+			}
+		}
+
+		if req.RequireStarted {
+			if status, output = checkContainerRunning(pod, container.Name); status != "0" {
+				result.Reason = "not-running"
+				return done(status, output)
+			}
+		}
+
+		if req.NoRestartWithin > 0 {
+			if status, output = checkNoRestartWithin(pod, container.Name, req.NoRestartWithin); status != "0" {
+				return done(status, output)
+			}
+		}
+
+		if req.auditsProbes() {
+			return done(checkProbes(container, req))
+		}
+
+		if req.auditsLimits() {
+			return done(checkLimits(container, req))
+		}
+
+		if req.ExpectHostname != "" {
+			return done(checkHostname(ctx, config, kubeClient, req, pod.Name, container.Name))
+		}
+
+		if req.ProbeType != "" {
+			status, reason, output := runProbe(ctx, config, kubeClient, req, pod.Name, container)
+			result.Reason = reason
+			return done(status, output)
+		}
+
+		if req.PreExec != "" {
+			if err := runPreExec(ctx, config, kubeClient, req, pod.Name, container.Name); err != nil {
+				return done("UNKNOWN", fmt.Errorf("Pre-exec failed: %w", err))
+			}
+		}
+
+		setLogField("step", "exec")
+		command, stdinLines, err := execCommandLine(execReq)
+		if err != nil {
+			return done("UNKNOWN", err)
+		}
+		shell := ""
+		if len(req.ShellFallback) > 0 && shells[path.Base(execReq.Command)] {
+			if shell, err = findShell(ctx, config, kubeClient, req, pod.Name, name); err != nil {
+				status, output = "UNKNOWN", err
+				log.Printf(`No shell in container "%v": %v`, name, err)
+				continue
+			}
+			command = append(strings.Fields(shell), command[1:]...)
+			// the allowlist was checked with the shell of the request
+			if req.allowedCommandsFile != "" {
+				if err := checkAllowedArgv(req, command, execReq.Arg); err != nil {
+					return done("UNKNOWN", err)
+				}
+			}
+		}
+		if req.printKubectl {
+			fmt.Fprintln(os.Stderr, kubectlCommand(req, pod.Name, container.Name, command, stdinLines))
+		}
+		// an output mismatch with an OK exit code may be retried, for an
+		// eventually consistent output
+		var exitCode int
+		var stdout, stderr, reason, message string
+		var rate *outputRate
+		attempts := 0
+		for {
+			attempts++
+			start := time.Now()
+			if req.MeasureThroughput {
+				rate = newOutputRate()
+			}
+			execCtx, span := startSpan(ctx, "exec", attribute.String("k8s.pod.name", pod.Name), attribute.String("k8s.container.name", name))
+			exitCode, stdout, stderr, err = execCommandRate(execCtx, config, kubeClient, req, pod.Name, name, command, stdinLines, rate)
+			span.SetAttributes(attribute.Int("process.exit_code", exitCode))
+			endSpan(span, err)
+			timings.Exec = time.Since(start)
+			if attempts > 1 {
+				req.budget.spend(timings.Exec)
+			}
+			if err != nil {
+				status, output = "UNKNOWN", err
+				log.Printf(`Exec failed in container "%v": %v`, name, err)
+				continue containers
+			}
+			result.ExitCode, result.Stdout, result.Stderr = exitCode, stdout, stderr
+
+			if req.Decompress != "" {
+				if stdout, err = decompressOutput(req.Decompress, stdout); err != nil {
+					result.Reason = "output-mismatch"
+					return done("2", fmt.Sprintf("Exit Code: %v, failed to decompress %v output: %v", exitCode, req.Decompress, err))
+				}
+				result.Stdout = stdout
+			}
+
+			status, reason, message, err = evaluateExec(req, exitCode, stdout, stderr)
+			if err != nil {
+				return done("UNKNOWN", err)
+			}
+			if reason != "output-mismatch" || req.StatusFromOutput || attempts > req.MismatchRetries || ctx.Err() != nil {
 				break
 			}
+			delay := retryBackoff(req.MismatchBackoff, attempts)
+			log.Printf(`Output mismatch in container "%v", attempt %v/%v, retrying in %v`, name, attempts, req.MismatchRetries+1, delay)
+			if err := req.budget.wait(ctx, delay); err != nil {
+				return done("UNKNOWN", fmt.Errorf("%w after %v attempts, %v", err, attempts, message))
+			}
+		}
+		result.Reason = reason
+		if req.SoftTimeout > 0 && timings.Exec > req.SoftTimeout && status == "0" {
+			status, message = "1", fmt.Sprintf("%v, exec slow: %v over %v", message, timings.Exec.Round(time.Millisecond), req.SoftTimeout)
+			result.Reason = "timeout"
+		}
+		if attempts > 1 {
+			message = fmt.Sprintf("%v (%v attempts)", message, attempts)
+		}
+		if shell != "" && shell != req.Command {
+			message = fmt.Sprintf(`%v (shell "%v")`, message, shell)
+		}
+		if execReq != req {
+			message = fmt.Sprintf(`%v (windows, shell "%v")`, message, execReq.Command)
+		}
+		if len(containers) > 1 {
+			message = fmt.Sprintf(`%v (container "%v")`, message, container.Name)
 		}
-		if notFound {
-			return "UNKNOWN", fmt.Sprintf(`Container "%v" not found`, req.Container)
+		perfData, err := jsonPerfData(req, stdout)
+		if err != nil {
+			return done("UNKNOWN", err)
 		}
+		perfData = append([]string{timings.PerfData()}, perfData...)
+		if rate != nil {
+			perfData = append(perfData, rate.PerfData())
+		}
+		message = fmt.Sprintf("%v | %v", message, strings.Join(perfData, " "))
+		if status != "0" || req.OutputOnSuccess {
+			message += commandOutput(req, stdout, stderr)
+		}
+		return done(status, message)
+	}
+
+	return done(status, output)
+}
+
+// maxCommandOutput bounds the command output added to the check output,
+// the full output being available with the output file.
+const maxCommandOutput = 4096
+
+// commandOutput formats the command stdout and stderr as the long output of
+// the check, following its first line, or returns an empty string if there
+// is no output. Runs of identical lines are collapsed, e.g. the repeated
+// warnings of a chatty command.
+func commandOutput(req *Request, stdout, stderr string) string {
+	output := strings.TrimSpace(strings.TrimSpace(printableOutput(stdout)) + "\n" + strings.TrimSpace(printableOutput(stderr)))
+	if output == "" {
+		return ""
+	}
+	if req.CollapseRepeated > 1 {
+		output = collapseRepeatedLines(output, req.CollapseRepeated)
+	}
+	if len(output) > maxCommandOutput {
+		output = output[:maxCommandOutput] + "... (truncated)"
+	}
+	return "\n" + output
+}
+
+// isBinaryOutput reports whether the output is not text, either not valid
+// UTF-8 or holding NUL bytes, which would garble the check output.
+func isBinaryOutput(output string) bool {
+	return !utf8.ValidString(output) || strings.ContainsRune(output, 0)
+}
+
+// printableOutput returns the output, or a placeholder giving its size if it
+// is binary.
+func printableOutput(output string) string {
+	if isBinaryOutput(output) {
+		return fmt.Sprintf("<binary output, %v bytes>", len(output))
+	}
+	return output
+}
+
+// collapseRepeatedLines replaces each run of at least threshold identical
+// consecutive lines with a single one marked with the repetition count.
+func collapseRepeatedLines(text string, threshold int) string {
+	lines := strings.Split(text, "\n")
+	var collapsed []string
+	for i := 0; i < len(lines); {
+		j := i + 1
+		for j < len(lines) && lines[j] == lines[i] {
+			j++
+		}
+		if j-i >= threshold {
+			collapsed = append(collapsed, fmt.Sprintf("%v (repeated %v times)", lines[i], j-i))
+		} else {
+			collapsed = append(collapsed, lines[i:j]...)
+		}
+		i = j
 	}
+	return strings.Join(collapsed, "\n")
+}
 
-	log.Printf(`Container "%v" found`, req.Container)
+// execCommand runs the command in the container of the pod, writing the
+// stdin lines to it, and returns its exit code, stdout and stderr. When the
+// output is combined, stderr is empty as it is part of stdout.
+func execCommand(ctx context.Context, config *rest.Config, kubeClient *kubernetes.Clientset, req *Request, pod, container string, command, stdinLines []string) (int, string, string, error) {
+	return execCommandRate(ctx, config, kubeClient, req, pod, container, command, stdinLines, nil)
+}
 
+// execCommandRate runs the command as execCommand does, measuring the
+// throughput of its stdout into rate unless it is nil.
+func execCommandRate(ctx context.Context, config *rest.Config, kubeClient *kubernetes.Clientset, req *Request, pod, container string, command, stdinLines []string, rate *outputRate) (int, string, string, error) {
+	exec, err := newExecutor(config, kubeClient, req, pod, container, command, true)
+	if err != nil {
+		return 0, "", "", err
+	}
+
+	stdIn := newStringReader(stdinLines, stdinSeparators[req.StdinSeparator])
+	if req.KeepStdinOpen {
+		stdinCtx, closeStdin := context.WithCancel(ctx)
+		defer closeStdin()
+		stdIn = &openReader{ctx: stdinCtx, reader: stdIn}
+	}
+	stdOut := &Writer{rate: rate}
+	stdErr := new(Writer)
+	var stdoutStream, stderrStream io.Writer = stdOut, stdErr
+	output := stdOut.String
+	if req.CombineOutput {
+		combined := &combinedOutput{rate: rate}
+		stdoutStream, stderrStream = combined.stream(false), combined.stream(true)
+		output = combined.String
+	}
+
+	release, err := acquireStream(ctx, req, config.Host)
+	if err != nil {
+		return 0, "", "", err
+	}
+	err = exec.StreamWithContext(ctx, remotecommand.StreamOptions{
+		Stdin:  stdIn,
+		Stdout: stdoutStream,
+		Stderr: stderrStream,
+		Tty:    false,
+	})
+	release()
+	if rate != nil {
+		rate.stop()
+	}
+	stdout, stderr := output(), stdErr.String()
+	if req.outputFile != "" {
+		writeOutputFile(req, pod, container, command, stdinLines, stdout, stderr, err)
+	}
+
+	exitCode, err := execExitCode(ctx, err)
+	if err != nil {
+		return 0, "", "", err
+	}
+	return exitCode, stdout, stderr, nil
+}
+
+// newExecutor creates the executor of the command in the container of the
+// pod, with a stdin stream if requested.
+func newExecutor(config *rest.Config, kubeClient *kubernetes.Clientset, req *Request, pod, container string, command []string, stdin bool) (remotecommand.Executor, error) {
 	execRequest := kubeClient.CoreV1().RESTClient().Post().
 		Resource("pods").
-		Name(req.Pod).
+		Name(pod).
 		Namespace(req.Namespace).
 		SubResource("exec").
-		Param("container", req.Container).
-		Param("command", req.Command).
-		Param("stdin", "true").
-		Param("stdout", "false").
-		Param("stderr", "false").
+		Param("container", container).
+		Param("stdin", strconv.FormatBool(stdin)).
+		Param("stdout", "true").
+		Param("stderr", "true").
 		Param("tty", "false")
+	for _, arg := range command {
+		execRequest.Param("command", arg)
+	}
 
 	exec, err := remotecommand.NewSPDYExecutor(config, "POST", execRequest.URL())
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create executor: %w", err)
+	}
+	return exec, nil
+}
+
+// execExitCode returns the exit code of the command from the error of its
+// stream, or the error preventing to find it.
+func execExitCode(ctx context.Context, err error) (int, error) {
+	if err == nil {
+		return 0, nil
+	}
+	if exitErr, ok := err.(utilexec.ExitError); ok && exitErr.Exited() {
+		return exitErr.ExitStatus(), nil
+	}
+	if ctx.Err() != nil {
+		return 0, fmt.Errorf("Exec aborted: %w", ctx.Err())
+	}
+	// the SPDY upgrade is rejected when RBAC does not allow pods/exec, with
+	// a Forbidden status unless the response body is not a status
+	msg := strings.ToLower(err.Error())
+	if apierrors.IsForbidden(err) || (strings.Contains(msg, "unable to upgrade connection") && strings.Contains(msg, "forbidden")) {
+		return 0, fmt.Errorf("[auth] Missing pods/exec permission: %w", err)
+	}
+	return 0, fmt.Errorf("Failed to find exit code: %w", err)
+}
+
+// preExecShell runs the pre-exec command.
+const preExecShell = "/bin/sh"
+
+// runPreExec runs the pre-exec command in the container, failing unless it
+// exits 0 within the pre-exec timeout.
+func runPreExec(ctx context.Context, config *rest.Config, kubeClient *kubernetes.Clientset, req *Request, pod, container string) error {
+	ctx, cancel := context.WithTimeout(ctx, req.PreExecTimeout)
+	defer cancel()
+	exitCode, _, _, err := execCommand(ctx, config, kubeClient, req, pod, container, []string{preExecShell, "-c", req.PreExec}, nil)
+	if err != nil {
+		return err
+	}
+	if exitCode != 0 {
+		return fmt.Errorf("Exit Code: %v", exitCode)
+	}
+	log.Printf(`Pre-exec "%v" succeeded`, req.PreExec)
+	return nil
+}
+
+// findShell returns the first shell, among the exec command one and the
+// fallback ones, which can be run in the container. Each one is tried with a
+// command which only exits 0.
+func findShell(ctx context.Context, config *rest.Config, kubeClient *kubernetes.Clientset, req *Request, pod, container string) (string, error) {
+	for _, shell := range append([]string{req.Command}, req.ShellFallback...) {
+		command := append(strings.Fields(shell), "-c", "exit 0")
+		exitCode, _, _, err := execCommand(ctx, config, kubeClient, req, pod, container, command, nil)
+		if err == nil && exitCode != 0 {
+			err = fmt.Errorf("Exit Code: %v", exitCode)
+		}
+		if err == nil {
+			log.Printf(`Using shell "%v"`, shell)
+			return shell, nil
+		}
+		log.Printf(`Shell "%v" not usable: %v`, shell, err)
+	}
+	return "", fmt.Errorf("No usable shell found")
+}
+
+// checkHostname runs "hostname -f" in the container and asserts that the
+// pod FQDN, as set for a StatefulSet pod by its headless service, is the
+// expected one.
+func checkHostname(ctx context.Context, config *rest.Config, kubeClient *kubernetes.Clientset, req *Request, pod, container string) (string, interface{}) {
+	exitCode, stdout, _, err := execCommand(ctx, config, kubeClient, req, pod, container, []string{"hostname", "-f"}, nil)
 	if err != nil {
 		return "UNKNOWN", err
 	}
+	if exitCode != 0 {
+		return "UNKNOWN", fmt.Errorf(`Exit Code: %v, failed to run "hostname -f"`, exitCode)
+	}
+	hostname := strings.TrimSpace(stdout)
+	if hostname != req.ExpectHostname {
+		return "2", fmt.Sprintf(`Hostname "%v" is not "%v"`, hostname, req.ExpectHostname)
+	}
+	return "0", fmt.Sprintf(`Hostname is "%v"`, hostname)
+}
 
-	stdIn := newStringReader([]string{"-c", req.Arg})
-	stdOut := new(Writer)
-	stdErr := new(Writer)
+const serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
 
-	err = exec.Stream(remotecommand.StreamOptions{
-		Stdin:  stdIn,
-		Stdout: stdOut,
-		Stderr: stdErr,
-		Tty:    false,
-	})
+// resolveNamespace reads the namespace from the namespace file when it is not
+// set, else from the current kubeconfig context. When running in a pod
+// without kubeconfig, it is the service account one, and the namespace
+// defaults to "default" if it can't be read.
+func resolveNamespace(req *Request) error {
+	if req.Namespace != "" {
+		return nil
+	}
 
-	var exitCode int
-	if err == nil {
-		exitCode = 0
+	if req.namespaceFile != "" {
+		data, err := ioutil.ReadFile(req.namespaceFile)
+		if err != nil {
+			return fmt.Errorf("Failed to read namespace file: %w", err)
+		}
+		req.Namespace = strings.TrimSpace(string(data))
+		if req.Namespace == "" {
+			return fmt.Errorf(`No namespace found in namespace file "%v"`, req.namespaceFile)
+		}
+		return nil
+	}
+
+	// as kubectl does, the namespace of the current kubeconfig context is
+	// used, else the in-cluster one, else "default"
+	if namespace, _, err := kubeconfig(req).Namespace(); err == nil && namespace != "" {
+		req.Namespace = namespace
+		return nil
+	}
+	if os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		if data, err := ioutil.ReadFile(serviceAccountNamespaceFile); err == nil {
+			req.Namespace = strings.TrimSpace(string(data))
+		}
+	}
+	if req.Namespace == "" {
+		req.Namespace = "default"
+	}
+	return nil
+}
+
+// checkCAFile ensures the certificate authority file is readable and holds
+// at least one PEM encoded certificate.
+func checkCAFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("Failed to read certificate authority file: %w", err)
+	}
+	if !x509.NewCertPool().AppendCertsFromPEM(data) {
+		return fmt.Errorf(`No PEM certificate found in certificate authority file "%v"`, path)
+	}
+	return nil
+}
+
+// containerNames lists the names of the containers of the pod spec, to
+// report which ones exist when the checked one does not.
+func containerNames(pod *corev1.Pod) string {
+	names := make([]string, len(pod.Spec.Containers))
+	for i, container := range pod.Spec.Containers {
+		names[i] = container.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// getContainer returns the named container of the pod, or the first one,
+// which exec defaults to, if name is empty.
+func getContainer(pod *corev1.Pod, name string) *corev1.Container {
+	for i := range pod.Spec.Containers {
+		if name == "" || pod.Spec.Containers[i].Name == name {
+			return &pod.Spec.Containers[i]
+		}
+	}
+	return nil
+}
+
+// checkRunAsUser asserts, from the pod spec, that the container runs as the
+// given user ID. As in Kubernetes, the container security context takes
+// precedence over the pod one.
+func checkRunAsUser(pod *corev1.Pod, container *corev1.Container, uid int64) (string, interface{}) {
+	var runAsUser *int64
+	if pod.Spec.SecurityContext != nil {
+		runAsUser = pod.Spec.SecurityContext.RunAsUser
+	}
+	if container.SecurityContext != nil && container.SecurityContext.RunAsUser != nil {
+		runAsUser = container.SecurityContext.RunAsUser
+	}
+
+	if runAsUser == nil {
+		return evaluate(false, fmt.Sprintf(`runAsUser not set for container "%v"`, container.Name))
+	}
+	return evaluate(*runAsUser == uid, fmt.Sprintf(`Container "%v" runs as UID %v`, container.Name, *runAsUser))
+}
+
+// checkContainerRunning asserts that the container has started and is still
+// running, from the pod status.
+func checkContainerRunning(pod *corev1.Pod, name string) (string, interface{}) {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name != name {
+			continue
+		}
+		switch {
+		case status.State.Running != nil:
+			return evaluate(true, fmt.Sprintf(`Container "%v" running`, name))
+		case status.State.Waiting != nil:
+			return evaluate(false, fmt.Sprintf(`Container "%v" not running (%v)`, name, status.State.Waiting.Reason))
+		case status.State.Terminated != nil:
+			return evaluate(false, fmt.Sprintf(`Container "%v" not running (%v)`, name, status.State.Terminated.Reason))
+		}
+	}
+	return evaluate(false, fmt.Sprintf(`Container "%v" not running (no status)`, name))
+}
+
+// checkNoRestartWithin asserts that the container did not restart within the
+// window: its current run started, or else its previous one finished, long
+// enough ago. The check is in CRITICAL state otherwise, or if the container
+// has no status yet.
+func checkNoRestartWithin(pod *corev1.Pod, name string, window time.Duration) (string, interface{}) {
+	status := findContainerStatus(pod.Status.ContainerStatuses, name)
+	if status == nil {
+		return evaluate(false, fmt.Sprintf(`Container "%v" not running (no status)`, name))
+	}
+	if status.RestartCount == 0 {
+		return evaluate(true, fmt.Sprintf(`Container "%v" never restarted`, name))
+	}
+	var restartedAt time.Time
+	switch {
+	case status.State.Running != nil:
+		restartedAt = status.State.Running.StartedAt.Time
+	case status.LastTerminationState.Terminated != nil:
+		restartedAt = status.LastTerminationState.Terminated.FinishedAt.Time
+	default:
+		return evaluate(false, fmt.Sprintf(`Container "%v" restarted %v times, last restart time unknown`, name, status.RestartCount))
+	}
+	since := time.Since(restartedAt).Round(time.Second)
+	if since >= window {
+		return evaluate(true, fmt.Sprintf(`Container "%v" restarted %v ago (%v restarts), more than %v`, name, since, status.RestartCount, window))
+	}
+	return evaluate(false, fmt.Sprintf(`Container "%v" restarted %v ago (%v restarts), within %v`, name, since, status.RestartCount, window))
+}
+
+// checkPodCondition asserts that a pod condition, including custom readiness
+// gates, has the expected status, given as "type=status" or as "type" for
+// True. The check is in WARNING state otherwise.
+func checkPodCondition(pod *corev1.Pod, condition string) (string, interface{}) {
+	kv := strings.SplitN(condition, "=", 2)
+	expected := corev1.ConditionTrue
+	if len(kv) == 2 {
+		expected = corev1.ConditionStatus(kv[1])
+	}
+
+	for _, c := range pod.Status.Conditions {
+		if string(c.Type) != kv[0] {
+			continue
+		}
+		if !strings.EqualFold(string(c.Status), string(expected)) {
+			return "1", fmt.Sprintf(`Pod condition "%v" is %v, expected %v: %v`, c.Type, c.Status, expected, c.Message)
+		}
+		return "0", fmt.Sprintf(`Pod condition "%v" is %v`, c.Type, c.Status)
+	}
+	return "1", fmt.Sprintf(`Pod condition "%v" not found`, kv[0])
+}
+
+// checkPodAge warns if the pod, aged from its start time or else its creation
+// time, is younger than minAge or older than maxAge. A zero bound is not checked.
+func checkPodAge(pod *corev1.Pod, minAge, maxAge time.Duration) (string, interface{}) {
+	age := time.Since(podStartTime(pod)).Round(time.Second)
+
+	if minAge > 0 && age < minAge {
+		return "1", fmt.Sprintf("Pod age %v is below the minimum %v", age, minAge)
+	}
+	if maxAge > 0 && age > maxAge {
+		return "1", fmt.Sprintf("Pod age %v is above the maximum %v", age, maxAge)
+	}
+	return "0", fmt.Sprintf("Pod age is %v", age)
+}
+
+// checkPodTerminating reports a pod being deleted, whose exec results are
+// unreliable, with the given status, UNKNOWN by default.
+func checkPodTerminating(pod *corev1.Pod, statusName string) (string, interface{}) {
+	status, ok := outputStatuses[statusName]
+	if !ok {
+		status = "UNKNOWN"
+	}
+	return status, fmt.Sprintf(`Pod "%v" is terminating since %v`, pod.Name, pod.DeletionTimestamp.Format(time.RFC3339))
+}
+
+// checkPodLabel asserts that a pod annotation or label holds the expected
+// value, given as "key=value", without running any exec.
+func checkPodLabel(pod *corev1.Pod, expectLabel string) (string, interface{}) {
+	kv := strings.SplitN(expectLabel, "=", 2)
+	if len(kv) != 2 {
+		return "UNKNOWN", fmt.Errorf(`Invalid label check "%v" [Format: 'key=value']`, expectLabel)
+	}
+
+	value, found := pod.Annotations[kv[0]]
+	if !found {
+		value, found = pod.Labels[kv[0]]
+	}
+	if !found {
+		return evaluate(false, fmt.Sprintf(`Label "%v" not found`, kv[0]))
+	}
+
+	return evaluate(value == kv[1], fmt.Sprintf(`Label "%v": "%v"`, kv[0], value))
+}
+
+// evaluateExec maps the exit code, stdout and stderr of the exec command to the
+// check status, reason and message.
+func evaluateExec(req *Request, exitCode int, stdout, stderr string) (string, string, string, error) {
+	if req.StatusFromOutput {
+		status, reason, message := statusFromOutput(stdout)
+		return status, reason, message, nil
+	}
+
+	message := fmt.Sprintf("Exit Code: %v", exitCode)
+	if req.Interpret {
+		if meaning := interpretExitCode(req, exitCode); meaning != "" {
+			message = fmt.Sprintf("%v (%v)", message, meaning)
+		}
+	}
+
+	var status string
+	if req.IgnoreExitCode {
+		status, message = "0", fmt.Sprintf("%v (ignored)", message)
+	} else if req.StatusMapFile != "" {
+		ranges, err := readStatusMap(req.StatusMapFile)
+		if err != nil {
+			return "", "", "", err
+		}
+		status = mapExitCode(ranges, exitCode)
 	} else {
-		if exitErr, ok := err.(utilexec.ExitError); ok && exitErr.Exited() {
-			exitCode = exitErr.ExitStatus()
-		} else {
-			return "UNKNOWN", fmt.Sprintf("Failed to find exit code: %v", err)
+		okCodes := req.OkCodes
+		if len(okCodes) == 0 {
+			okCodes = []int{0}
+		}
+		ok := false
+		for _, code := range okCodes {
+			ok = ok || exitCode == code
 		}
+		status, message = evaluate(ok, message)
+	}
+	if diagnosis := diagnoseExitCode(req, exitCode); status != "0" && diagnosis != "" {
+		message = fmt.Sprintf("%v, %v", message, diagnosis)
 	}
 
-	output := fmt.Sprintf("Exit Code: %v", exitCode)
-	if exitCode != 0 {
-		exitCode = 2
+	if status != "0" {
+		return status, "bad-exit-code", message, nil
+	}
+	if req.Strict && strings.TrimSpace(stderr) != "" {
+		status, message = evaluate(false, fmt.Sprintf("%v, unexpected stderr output", message))
+		return status, "output-mismatch", message, nil
+	}
+	mismatch, err := checkOutput(req, stdout)
+	if err != nil {
+		return "", "", "", err
+	}
+	if mismatch != "" {
+		status, message = evaluate(false, fmt.Sprintf("%v, %v", message, mismatch))
+		return status, "output-mismatch", message, nil
+	}
+	return status, "ok", message, nil
+}
+
+var statusNames = map[string]string{
+	"0":       "OK",
+	"1":       "WARNING",
+	"2":       "CRITICAL",
+	"UNKNOWN": "UNKNOWN",
+}
+
+var outputStatuses = map[string]string{
+	"OK":       "0",
+	"WARNING":  "1",
+	"CRITICAL": "2",
+	"UNKNOWN":  "UNKNOWN",
+}
+
+// statusFromOutput reads the check status from the first line of the command
+// stdout, regardless of its exit code. The reason is "status-word", or
+// "output-mismatch" if the line is not a status.
+func statusFromOutput(stdout string) (string, string, string) {
+	line := strings.TrimSpace(strings.SplitN(stdout, "\n", 2)[0])
+	status, ok := outputStatuses[strings.ToUpper(line)]
+	if !ok {
+		return "UNKNOWN", "output-mismatch", fmt.Sprintf(`No status in first output line "%v"`, printableOutput(line))
 	}
+	return status, "status-word", fmt.Sprintf("Output status: %v", line)
+}
+
+// checkAnnotationFreshness asserts that a pod annotation, such as the
+// heartbeat written by a sidecar, holds an RFC3339 timestamp not older than
+// maxStaleness, without running any exec.
+func checkAnnotationFreshness(pod *corev1.Pod, key string, maxStaleness time.Duration) (string, interface{}) {
+	value, found := pod.Annotations[key]
+	if !found {
+		return evaluate(false, fmt.Sprintf(`Annotation "%v" not found`, key))
+	}
+	timestamp, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return "UNKNOWN", fmt.Errorf(`Annotation "%v" is not an RFC3339 timestamp: %w`, key, err)
+	}
+
+	staleness := time.Since(timestamp).Round(time.Second)
+	message := fmt.Sprintf(`Annotation "%v" is %v old | staleness=%.0fs`, key, staleness, staleness.Seconds())
+	return evaluate(staleness <= maxStaleness, message)
+}
 
-	return fmt.Sprintf("%v", exitCode), output
+// evaluate maps the outcome of a check to its status code.
+func evaluate(ok bool, output string) (string, string) {
+	if !ok {
+		return "2", output
+	}
+	return "0", output
 }
 
 type Request struct {
 	masterURL      string
 	kubeconfigPath string
+	caFile         string
+	tokenFile      string
+	namespaceFile  string
+	headers        []string
+	userAgent      string
+
+	allowedCommandsFile string
+	cacheTTL            time.Duration
+	textfileOutput      string
+	outputFormat        string
+	dumpPod             bool
+	printKubectl        bool
+	webhookURL          string
+	webhookOn           string
+	cloudEventsSink     string
+	logFormat           string
+	outputFile          string
+	auditFile           string
+	resultFile          string
+	trace               bool
+	otlpEndpoint        string
+
+	breakerThreshold   int
+	breakerCooldown    time.Duration
+	breakerMaxCooldown time.Duration
+	maxStreams         int
+
+	deadline time.Time
+	budget   *retryBudget
+	client   *sharedClient
+	ownerUID types.UID
+
+	Pod             string
+	PodIP           string
+	StatefulSet     string
+	Ordinal         int
+	Deployment      string
+	ReplicaSet      string
+	PodTemplateHash string
+	Selector        string
+	AllPods         bool
+	ComparePods     bool
+	Newest          bool
+	ExpectSingle    bool
+	Count           int
+	Compact         bool
+	Delay           time.Duration
+	FailFast        bool
+	Concurrency     int
 
-	Pod       string
-	Container string
-	Namespace string
-	Command   string
-	Arg       string
+	Container         string
+	ContainerIndex    int
+	ContainerFallback []string
+	Logic             string
+	ContainerCommands []string
+	Namespace         string
+	Namespaces        []string
+	CheckNamespace    bool
+	PreExec           string
+	PreExecTimeout    time.Duration
+	Command           string
+	ShellFallback     []string
+	OS                string
+	Arg               string
+	CommandArgs       []string
+	Template          bool
+	RunAlias          string
+	CommandAliases    []string
+	AliasesFile       string
+	Timeout           time.Duration
+	SoftTimeout       time.Duration
+	StdinSeparator    string
+	StdinBase64       string
+	KeepStdinOpen     bool
+	Workdir           string
+	CombineOutput     bool
+	MeasureThroughput bool
+	OutputOnSuccess   bool
+	CollapseRepeated  int
+
+	MinPodAge              time.Duration
+	MaxPodAge              time.Duration
+	TerminatingStatus      string
+	AllowedPhases          []string
+	MissingContainerStatus string
+	ExpectLabel            string
+	FreshAnnotation        string
+	MaxStaleness           time.Duration
+	ExpectHostname         string
+	ExpectLivenessPath     string
+	ExpectReadinessPath    string
+	ExpectCPULimit         string
+	ProbeType              string
+	HTTPGet                string
+	ExpectMemoryLimit      string
+	RunAsUID               int64
+	RequireStarted         bool
+	TolerateNotReady       bool
+	WaitSidecar            string
+	WaitSidecarTimeout     time.Duration
+	NoRestartWithin        time.Duration
+	RequireRolloutComplete bool
+	RequireConditions      []string
+
+	Interpret        bool
+	ShowEvents       bool
+	ShowPDB          bool
+	EmitEvent        bool
+	Decompress       string
+	ExpectOutput     []string
+	MatchMode        string
+	NormalizeOutput  []string
+	MismatchRetries  int
+	MismatchBackoff  time.Duration
+	RetryBudget      time.Duration
+	ExpectJSONPath   string
+	PerfFromJSON     []string
+	StatusFromOutput bool
+	IgnoreExitCode   bool
+	ExpectFile       string
+	ExpectFileType   string
+	Strict           bool
+	OkCodes          []int
+	StatusMapFile    string
+}
+
+// runContext returns the context of a check run, canceled on SIGINT or SIGTERM,
+// and once the timeout has passed unless it is zero, or at the deadline if it
+// is earlier.
+func runContext(req *Request) (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	deadline := req.deadline
+	if req.Timeout > 0 && (deadline.IsZero() || time.Now().Add(req.Timeout).Before(deadline)) {
+		deadline = time.Now().Add(req.Timeout)
+	}
+	if deadline.IsZero() {
+		return ctx, stop
+	}
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	return ctx, func() {
+		cancel()
+		stop()
+	}
 }
 
 func NewCmd() *cobra.Command {
 	var req Request
+	var deadline string
 	c := &cobra.Command{
-		Use:     "check_pod_exec",
+		Use:     "check_pod_exec [flags] [-- COMMAND [ARG...]]",
 		Short:   "Check exit code of exec command on Kubernetes container",
 		Example: "",
+		Args: func(cmd *cobra.Command, args []string) error {
+			// the exec command follows "--", so that a mistyped subcommand
+			// is not run as a command
+			if len(args) > 0 && cmd.ArgsLenAtDash() != 0 {
+				return fmt.Errorf(`Unknown command "%v", the exec command must follow "--"`, args[0])
+			}
+			return nil
+		},
 
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := bindEnv(cmd.Flags()); err != nil {
+				return err
+			}
+			if err := setLogFormat(req.logFormat); err != nil {
+				return err
+			}
+			if req.OS != "auto" && req.OS != "node" && req.OS != "linux" && req.OS != "windows" {
+				return fmt.Errorf(`Unsupported operating system "%v"`, req.OS)
+			}
+			if _, ok := outputFormats[req.outputFormat]; !ok {
+				return fmt.Errorf(`Unsupported output format "%v"`, req.outputFormat)
+			}
+			phases, err := normalizePhases(req.AllowedPhases)
+			if err != nil {
+				return err
+			}
+			req.AllowedPhases = phases
+			if _, ok := outputStatuses[req.TerminatingStatus]; !ok {
+				return fmt.Errorf(`Unsupported terminating pod status "%v"`, req.TerminatingStatus)
+			}
+			if req.MissingContainerStatus != "UNKNOWN" && req.MissingContainerStatus != "CRITICAL" {
+				return fmt.Errorf(`Unsupported missing container status "%v"`, req.MissingContainerStatus)
+			}
+			if req.FreshAnnotation != "" && req.MaxStaleness <= 0 {
+				return fmt.Errorf("Annotation freshness check requires a maximum staleness")
+			}
+			if req.Deployment != "" && req.ReplicaSet != "" {
+				return fmt.Errorf("Deployment and ReplicaSet are mutually exclusive")
+			}
+			if len(req.Namespaces) > 0 && req.Namespace != "" {
+				return fmt.Errorf("Namespace and namespaces are mutually exclusive")
+			}
+			if len(req.Namespaces) > 0 && req.textfileOutput != "" {
+				return fmt.Errorf("Textfile output is not supported with several namespaces")
+			}
+			if req.PodTemplateHash != "" && req.Selector == "" && req.Deployment == "" && req.ReplicaSet == "" && !req.AllPods {
+				return fmt.Errorf("Pod template hash requires a selector, a deployment or all pods")
+			}
+			if req.ComparePods && !req.AllPods {
+				return fmt.Errorf("Compare pods requires all pods")
+			}
+			if req.Concurrency < 0 {
+				return fmt.Errorf("Concurrency %v must not be negative", req.Concurrency)
+			}
+			if req.Concurrency > 1 && (req.Delay > 0 || req.FailFast) {
+				return fmt.Errorf("Concurrency is mutually exclusive with delay and fail fast, which check the pods in turn")
+			}
+			if req.Concurrency > 1 && hasPodDiagnostics(&req) {
+				return fmt.Errorf("Concurrency is mutually exclusive with dump pod, print kubectl and JSON logs, whose output would interleave")
+			}
+			if req.TolerateNotReady && req.AllPods {
+				return fmt.Errorf("Tolerate not ready and all pods are mutually exclusive")
+			}
+			if req.ProbeType != "" && req.ProbeType != "liveness" && req.ProbeType != "readiness" && req.ProbeType != "startup" {
+				return fmt.Errorf(`Unsupported probe type "%v"`, req.ProbeType)
+			}
+			if req.HTTPGet != "" {
+				if _, _, err := parseHTTPGet(req.HTTPGet); err != nil {
+					return err
+				}
+			}
+			if req.RequireRolloutComplete && req.Deployment == "" {
+				return fmt.Errorf("Rollout check requires a deployment")
+			}
+			if req.otlpEndpoint != "" && !req.trace {
+				return fmt.Errorf("OTLP endpoint requires tracing")
+			}
+			if req.Container != "" && req.ContainerIndex >= 0 {
+				return fmt.Errorf("Container name and index are mutually exclusive")
+			}
+			if req.Logic != "" && req.Logic != "and" && req.Logic != "or" {
+				return fmt.Errorf(`Unsupported container logic "%v"`, req.Logic)
+			}
+			if err := validateContainerCommands(&req); err != nil {
+				return err
+			}
+			if deadline != "" {
+				t, err := time.Parse(time.RFC3339, deadline)
+				if err != nil {
+					return fmt.Errorf(`Invalid deadline "%v" [Format: '2006-01-02T15:04:05Z07:00']`, deadline)
+				}
+				if time.Now().After(t) {
+					return fmt.Errorf("Deadline %v has passed", deadline)
+				}
+				req.deadline = t
+			}
+			if req.Timeout > 0 && req.SoftTimeout >= req.Timeout {
+				return fmt.Errorf("Soft timeout %v must be shorter than timeout %v", req.SoftTimeout, req.Timeout)
+			}
+			if req.breakerMaxCooldown < req.breakerCooldown {
+				return fmt.Errorf("Breaker max cooldown %v must not be shorter than breaker cooldown %v", req.breakerMaxCooldown, req.breakerCooldown)
+			}
+			if _, ok := stdinSeparators[req.StdinSeparator]; !ok {
+				return fmt.Errorf(`Unsupported stdin separator "%v"`, req.StdinSeparator)
+			}
+			if len(args) > 0 {
+				setCommandArgs(&req, args)
+			}
+			if req.ExpectFile != "" {
+				if len(args) > 0 {
+					return fmt.Errorf("Expect file and a command vector are mutually exclusive")
+				}
+				command, err := expectFileCommand(req.ExpectFile, req.ExpectFileType)
+				if err != nil {
+					return err
+				}
+				setCommandArgs(&req, command)
+			}
+			if req.RunAlias != "" {
+				if len(args) > 0 || req.ExpectFile != "" {
+					return fmt.Errorf("Run alias is mutually exclusive with a command vector and expect file")
+				}
+				command, err := resolveCommandAlias(&req)
+				if err != nil {
+					return err
+				}
+				setCommandArgs(&req, command)
+			}
+			if req.StdinSeparator != "newline" && (len(req.CommandArgs) > 0 || req.Workdir != "" || req.StdinBase64 != "") {
+				return fmt.Errorf("Stdin separator %v is mutually exclusive with a command vector, working directory and base64 stdin", req.StdinSeparator)
+			}
+			if err := validateWebhook(&req); err != nil {
+				return err
+			}
+			if req.Template {
+				if err := validateCommandTemplate(&req); err != nil {
+					return err
+				}
+			}
+			return validateExpectations(&req)
+		},
 		Run: func(cmd *cobra.Command, args []string) {
-			req.Namespace = "default"
-			req.Pod = "shell"
-			fmt.Printf(CheckKubeExec(&req))
+			shutdownTracing := startTracing(&req)
+			ctx, cancel := runContext(&req)
+			result := CheckKubeExecCached(ctx, &req)
+			cancel()
+			if req.resultFile != "" {
+				appendResultFile(&req, result)
+			}
+			postWebhook(&req, result)
+			waitCloudEvent := sendCloudEvent(&req, result)
+
+			output, err := outputFormats[req.outputFormat](result)
+			if err != nil {
+				log.Fatalf("Failed to format result: %v", err)
+			}
+			fmt.Println(output)
+			waitCloudEvent()
+			shutdownTracing()
+			os.Exit(result.ProcessExitCode())
 		},
 	}
 
 	c.Flags().StringVar(&req.masterURL, "master", req.masterURL, "The address of the Kubernetes API server (overrides any value in kubeconfig)")
-	c.Flags().StringVar(&req.kubeconfigPath, "kubeconfig", req.kubeconfigPath, "Path to kubeconfig file with authorization information (the master location is set by the master flag).")
+	c.Flags().StringVar(&req.kubeconfigPath, "kubeconfig", req.kubeconfigPath, "Path to kubeconfig file with authorization information, which may use a credential plugin (the master location is set by the master flag). [Default: KUBECONFIG, else ~/.kube/config, else in-cluster config]")
+	c.Flags().StringVar(&req.caFile, "certificate-authority", req.caFile, "Path to a cert file for the certificate authority (overrides any value in kubeconfig)")
+	c.Flags().StringVar(&req.tokenFile, "serviceaccount-token-file", req.tokenFile, "Path to a file holding the bearer token used to authenticate to the API server, re-read when the token is rotated")
+	c.Flags().StringArrayVar(&req.headers, "header", nil, "Extra header to send with API requests, including exec, may be repeated. [Format: 'KEY:VALUE']")
+	c.Flags().StringVar(&req.userAgent, "user-agent", "", "User-Agent of the API requests, to attribute them to the checks in the API server audit logs. [Default: checkexec/VERSION]")
+	c.Flags().StringVarP(&req.Namespace, "namespace", "n", "", "Namespace of the pod. [Default: read from namespace file, else the namespace of the kubeconfig context]")
+	c.Flags().StringSliceVar(&req.Namespaces, "namespaces", nil, "Namespaces to run the check in, each one as with the namespace flag, aggregating the results to the worst status. [Format: 'ns,ns,ns']")
+	c.Flags().BoolVar(&req.CheckNamespace, "check-namespace", false, "Get the namespace before the pod, to report a missing namespace instead of a missing pod")
+	c.Flags().StringVar(&req.namespaceFile, "namespace-file", "", "File holding the namespace of the pod. [Default: service account namespace file in a pod, else namespace 'default']")
+	c.Flags().StringVarP(&req.Pod, "pod", "p", "shell", "Pod name")
+	c.Flags().StringVar(&req.PodIP, "pod-ip", "", "IP of the pod, to find it by IP instead of name")
+	c.Flags().StringVar(&req.StatefulSet, "statefulset", "", "StatefulSet of the pod, which is selected by its ordinal")
+	c.Flags().IntVar(&req.Ordinal, "ordinal", 0, "Ordinal of the StatefulSet pod")
+	c.Flags().StringVar(&req.Deployment, "deployment", "", "Deployment of the pod, the first running pod matching its selector is checked")
+	c.Flags().StringVar(&req.ReplicaSet, "replicaset", "", "ReplicaSet of the pod, e.g. a canary revision, the first running pod it owns is checked")
+	c.Flags().StringVar(&req.PodTemplateHash, "pod-template-hash", "", "Only check the pods matching the selector with this pod-template-hash label, i.e. of a given ReplicaSet generation")
+	c.Flags().StringVarP(&req.Selector, "selector", "l", "", "Label selector of the pod, the first running pod matching it is checked")
+	c.Flags().BoolVar(&req.AllPods, "all-pods", false, "Check all the pods matching the selector, or all the pods of the namespace without selector")
+	c.Flags().BoolVar(&req.ComparePods, "compare-pods", false, "With --all-pods, also be CRITICAL if the stdout of the exec command, normalized as by --normalize-output, differs between the pods, reporting the diverging pods and their first differing line")
+	c.Flags().BoolVar(&req.TolerateNotReady, "tolerate-not-ready", false, "Check a ready pod matching the selector, else a running pod which is not ready, e.g. still starting up, reporting WARNING whatever the exec result rather than failing to find a pod. A named pod which is running but not ready is reported as WARNING too. Readiness is read once, there is no wait for it, only --wait-sidecar waits, for the sidecar, before exec")
+	c.Flags().BoolVar(&req.Newest, "newest", false, "Check the most recently started running pod matching the selector instead of the first one")
+	c.Flags().BoolVar(&req.ExpectSingle, "expect-single", false, "Fail if more than one pod matches the selector")
+	c.Flags().IntVar(&req.Count, "count", 1, "Run the check of a single pod this number of times, it is OK only if all of them pass")
+	c.Flags().DurationVar(&req.Delay, "delay", 0, "Pause between the execs of consecutive pods, or containers with logic, to avoid bursting the API server. [Default: no delay]")
+	c.Flags().BoolVar(&req.FailFast, "fail-fast", false, "Skip the remaining pods, iterations or containers with 'and' logic once one of them is CRITICAL")
+	c.Flags().IntVar(&req.Concurrency, "concurrency", 1, "Number of pods checked at once with --all-pods, their results being reported in the order of the pods. 0 checks min(pods, 4 * GOMAXPROCS) pods at once, or 1 with --delay, --fail-fast, --dump-pod, --print-kubectl or --log-format json. [Default: 1]")
+	c.Flags().BoolVar(&req.Compact, "compact", false, "Report the results of all pods on a single line")
 	c.Flags().StringVarP(&req.Container, "container", "C", "", "Container name in specified pod")
-	c.Flags().StringVarP(&req.Command, "cmd", "c", "/bin/sh", "Exec command. [Default: /bin/sh]")
+	c.Flags().IntVar(&req.ContainerIndex, "container-index", -1, "Index of the container in the pod spec, instead of its name")
+	c.Flags().StringVar(&req.Logic, "logic", "", "Check all the containers instead of falling back: with 'and' all of them must pass, with 'or' at least one. [Values: and, or]")
+	c.Flags().StringArrayVar(&req.ContainerCommands, "container-cmd", nil, "Exec command line of a container checked with logic, replacing the default exec command and its arguments in it, split at whitespace, may be repeated. [Format: 'container=command arg arg']")
+	c.Flags().StringVar(&req.Workdir, "workdir", "", "Working directory to run the exec command from, using a shell 'cd'")
+	c.Flags().BoolVar(&req.MeasureThroughput, "measure-throughput", false, "Add the exec command stdout size, its average rate over the exec and its peak rate, the most bytes received within one second, in bytes per second to the performance data")
+	c.Flags().BoolVar(&req.OutputOnSuccess, "output-on-success", false, "Add the exec command stdout and stderr to the check output of an OK check too, not only of a failed one")
+	c.Flags().IntVar(&req.CollapseRepeated, "collapse-repeated", 3, "Collapse the runs of at least this number of identical lines of the exec command output added to the check output into one, with its repetition count, 0 disables it")
+	c.Flags().BoolVar(&req.CombineOutput, "combine-output", false, "Merge the exec command stderr into its stdout, like '2>&1', before matching output")
+	c.Flags().StringSliceVar(&req.ContainerFallback, "container-fallback", nil, "Containers to try in order if the container is not found or exec fails in it. [Format: 'name,name,name']")
+	c.Flags().StringVar(&req.PreExec, "pre-exec", "", "Shell command to run in the container before the exec command, which only runs if it exits 0")
+	c.Flags().DurationVar(&req.PreExecTimeout, "pre-exec-timeout", 10*time.Second, "Timeout of the pre-exec command")
+	c.Flags().StringVarP(&req.Command, "cmd", "c", "/bin/sh", "Exec command, superseded by the command vector following '--' if any. [Default: /bin/sh]")
+	c.Flags().StringSliceVar(&req.ShellFallback, "shell-fallback", nil, "Shells to try in order if the exec command shell can't be run in the container. [Format: '/bin/bash,/bin/ash,/busybox sh']")
+	c.Flags().StringVar(&req.OS, "os", "auto", "Operating system of the pod, read from the pod spec or its kubernetes.io/os node selector with auto, else linux, and also from the labels of its node with node, which needs the permission to get nodes. On windows, a Linux shell is replaced by 'cmd /c'. [Values: auto, node, linux, windows]")
 	c.Flags().StringVarP(&req.Arg, "argv", "a", "", "Arguments for exec command. [Format: 'arg; arg; arg']")
+	c.Flags().BoolVar(&req.Template, "template", false, "Render the exec command, its arguments and the command vector as templates of the pod metadata, as in '{{.Name}}', '{{.Namespace}}' or '{{.Labels.app}}', a missing label or annotation being an error")
+	c.Flags().StringVar(&req.RunAlias, "run-alias", "", "Run the command of this alias as exec command, superseding the exec command and arguments flags")
+	c.Flags().StringArrayVar(&req.CommandAliases, "command-alias", nil, "Alias of a command line run by the shell, may be repeated, taking precedence over the aliases file. [Format: 'name=command line']")
+	c.Flags().StringVar(&req.AliasesFile, "command-aliases-file", "", "YAML or JSON file defining command aliases, as command lines run by the shell or command vectors. [Format: '{ping: \"redis-cli ping\", ready: [pg_isready, -q]}']")
+	c.Flags().DurationVar(&req.Timeout, "timeout", 0, "Fail with UNKNOWN if the check, including its API requests, does not complete within this duration. [Default: no timeout]")
+	c.Flags().StringVar(&deadline, "deadline", "", "Fail with UNKNOWN if the check does not complete by this time, e.g. the start of the next check window. The earlier of the timeout and the deadline applies. [Format: RFC3339] [Default: no deadline]")
+	c.Flags().DurationVar(&req.SoftTimeout, "soft-timeout", 0, "Warn if the exec command completes successfully but takes longer than this duration. [Default: no soft timeout]")
+	c.Flags().StringVar(&req.StdinBase64, "stdin-base64", "", "Base64 encoded data to write to the exec command stdin, for binary payloads")
+	c.Flags().BoolVar(&req.KeepStdinOpen, "keep-stdin-open", false, "Keep the exec command stdin open after its content instead of closing it, for commands failing on an early EOF. A command reading stdin until EOF then only ends at the timeout")
+	c.Flags().StringVar(&req.StdinSeparator, "stdin-separator", "newline", "Separator of the tokens written to the exec command stdin. With newline, the shell reads its arguments as its script. With null or space, the arguments flag is split into tokens at ';', which are written to stdin instead, for a command reading null or space separated input such as xargs. [Values: newline, null, space]")
+	c.Flags().IntSliceVar(&req.OkCodes, "ok-codes", []int{0}, "Exit codes of the exec command for which the check is OK, it is CRITICAL otherwise. [Format: 'code,code,code']")
+	c.Flags().StringVar(&req.StatusMapFile, "status-map-file", "", "YAML or JSON file mapping the exit codes of the exec command to statuses, superseding the OK exit codes, unmapped codes being CRITICAL. [Format: '{0: OK, 3: WARNING, \"10-20\": CRITICAL}']")
+	c.Flags().BoolVar(&req.StatusFromOutput, "status-from-output", false, "Read the status (OK, WARNING, CRITICAL or UNKNOWN) from the first line of the exec command stdout, ignoring its exit code")
+	c.Flags().BoolVar(&req.IgnoreExitCode, "ignore-exit-code", false, "Ignore the exit code of the exec command, bypassing --ok-codes and --strict on it, the status being given by --expect-output and --expect-jsonpath only")
+	c.Flags().StringVar(&req.ExpectFile, "expect-file", "", "Path of a file which must exist in the container, checked by running 'test -e PATH' as exec command")
+	c.Flags().StringVar(&req.ExpectFileType, "expect-file-type", "any", "Type of the expected file, checked with 'test -f', '-d', '-S' or '-L' instead of '-e'. [Values: any, file, dir, socket, symlink]")
+	c.Flags().BoolVar(&req.Strict, "strict", false, "Be CRITICAL unless the exec command exits with 0 and writes nothing but whitespace to stderr. An explicit --ok-codes or --status-map-file wins over the exit code requirement, --status-from-output disables strict mode and --combine-output leaves no stderr to check")
+	c.Flags().StringVar(&req.Decompress, "decompress", "", "Decompress the exec command stdout before matching it. [Values: gzip]")
+	c.Flags().StringArrayVar(&req.ExpectOutput, "expect-output", nil, "Regular expression the exec command stdout must match, may be repeated")
+	c.Flags().IntVar(&req.MismatchRetries, "retry-on-output-mismatch", 0, "Retry the exec command this number of times while it exits OK but its output does not match, for an eventually consistent output. Unrelated to the API connection errors. [Default: no retry]")
+	c.Flags().DurationVar(&req.RetryBudget, "retry-budget", 0, "Maximum total time spent retrying during the check, the backoff delays and the retried pod lookup and execs included, the check being UNKNOWN once it is exhausted. [Default: no budget]")
+	c.Flags().DurationVar(&req.MismatchBackoff, "retry-backoff", time.Second, "Delay before the first output mismatch retry, doubled at each retry up to 30s")
+	c.Flags().StringSliceVar(&req.NormalizeOutput, "normalize-output", nil, "Normalize the exec command stdout before matching the output regular expressions: trim removes the leading and trailing whitespace, collapse-space replaces each run of whitespace and newlines by a space, lowercase converts it to lower case. The JSONPath expectation is not affected. [Values: trim, collapse-space, lowercase]")
+	c.Flags().StringVar(&req.MatchMode, "match-mode", "all", "Whether all the output regular expressions must match, or any one. [Values: all, any]")
+	c.Flags().StringVar(&req.ExpectJSONPath, "expect-jsonpath", "", "JSONPath expression the exec command JSON stdout must match, optionally with the expected value. [Format: '{.status}=ok']")
+	c.Flags().StringArrayVar(&req.PerfFromJSON, "perf-from-json", nil, "Performance data to extract from the exec command JSON stdout, may be repeated. [Format: 'label=$.jsonpath']")
+	c.Flags().StringArrayVar(&req.RequireConditions, "require-condition", nil, "Warn without running exec if the pod condition, e.g. a readiness gate, does not have this status, may be repeated. [Format: 'type=True']")
+	c.Flags().DurationVar(&req.MinPodAge, "min-pod-age", 0, "Warn without running exec if the pod started less than this duration ago. [Default: no minimum]")
+	c.Flags().DurationVar(&req.MaxPodAge, "max-pod-age", 0, "Warn without running exec if the pod started more than this duration ago. [Default: no maximum]")
+	c.Flags().StringSliceVar(&req.AllowedPhases, "allowed-phases", nil, "Phases of the pod for which it is checked, it is CRITICAL without running exec in another phase. A running pod is checked by exec, a pod in another allowed phase, e.g. a Succeeded Job pod, is OK without exec. A selector picks a pod in one of these phases. [Format: 'phase,phase'] [Values: Pending, Running, Succeeded, Failed, Unknown] [Default: Running for a selector, no phase check for a pod name]")
+	c.Flags().StringVar(&req.TerminatingStatus, "terminating-status", "UNKNOWN", "Status of the check, without running exec, if the pod is terminating. [Values: OK, WARNING, CRITICAL, UNKNOWN]")
+	c.Flags().StringVar(&req.MissingContainerStatus, "missing-container-status", "UNKNOWN", "Status of the check if the container is not found in the pod, CRITICAL when it definitely should exist. [Values: UNKNOWN, CRITICAL]")
+	c.Flags().BoolVar(&req.RequireRolloutComplete, "require-rollout-complete", false, "Warn without running exec if a rollout of the deployment is in progress")
+	c.Flags().StringVar(&req.WaitSidecar, "wait-sidecar", "", "Wait for this sidecar container, e.g. istio-proxy or linkerd-proxy, or native sidecar init container, to be ready before running exec")
+	c.Flags().DurationVar(&req.WaitSidecarTimeout, "wait-sidecar-timeout", time.Minute, "Fail with UNKNOWN if the sidecar is not ready within this duration")
+	c.Flags().BoolVar(&req.RequireStarted, "require-started", false, "Fail without running exec if the container is not in running state")
+	c.Flags().DurationVar(&req.NoRestartWithin, "no-restart-within", 0, "Be CRITICAL without running exec if the container restarted less than this duration ago, reporting the time since its last restart. [Default: no restart check]")
+	c.Flags().BoolVar(&req.ShowEvents, "show-events", false, "Add the most recent warning events of the pod to the output of a failed check")
+	c.Flags().BoolVar(&req.EmitEvent, "emit-event", false, "Record a failed check as a Warning event of the pod, identical failures being aggregated at most once a minute")
+	c.Flags().BoolVar(&req.ShowPDB, "show-pdb", false, "Add whether the PodDisruptionBudget of the pod currently allows disruptions to the output")
+	c.Flags().BoolVar(&req.Interpret, "interpret", false, "Explain the exit code of well-known commands (curl, wget, grep, ...) in the output")
+	c.Flags().StringVar(&req.ExpectLabel, "expect-label", "", "Check pod annotation or label value instead of running exec command. [Format: 'key=value']")
+	c.Flags().StringVar(&req.FreshAnnotation, "fresh-annotation", "", "Check that this pod annotation holds an RFC3339 timestamp, e.g. a heartbeat, not older than the maximum staleness, instead of running exec command")
+	c.Flags().DurationVar(&req.MaxStaleness, "max-staleness", 0, "Maximum age of the fresh annotation timestamp")
+	c.Flags().StringVar(&req.ExpectHostname, "expect-hostname", "", "Check the FQDN of the pod, from 'hostname -f' in the container, instead of running exec command")
+	c.Flags().StringVar(&req.ExpectLivenessPath, "expect-liveness-path", "", "Check the HTTP path of the container liveness probe, from the pod spec, instead of running exec command")
+	c.Flags().StringVar(&req.ExpectReadinessPath, "expect-readiness-path", "", "Check the HTTP path of the container readiness probe, from the pod spec, instead of running exec command")
+	c.Flags().StringVar(&req.ExpectCPULimit, "expect-cpu-limit", "", "Check the CPU limit of the container, from the pod spec, instead of running exec command. [Format: '500m']")
+	c.Flags().StringVar(&req.ExpectMemoryLimit, "expect-memory-limit", "", "Check the memory limit of the container, from the pod spec, instead of running exec command. [Format: '256Mi']")
+	c.Flags().StringVar(&req.ProbeType, "probe-type", "", "Run the exec command of the container probe of this type, from the pod spec, within its timeout, instead of running exec command. [Values: liveness, readiness, startup]")
+	c.Flags().StringVar(&req.HTTPGet, "http-get", "", "Send an HTTP GET to this path and port of the pod through a port-forward, for containers without a shell, instead of running exec command. A 2xx or 3xx status passes. [Format: '/path:port']")
+	c.Flags().Int64Var(&req.RunAsUID, "assert-runas-uid", -1, "Fail if the container securityContext.runAsUser, read from the pod spec, is not this UID")
+	c.Flags().StringVar(&req.allowedCommandsFile, "allowed-commands-file", "", "File listing the exec command basenames allowed to run, one per line. For a shell, the first word of its script is checked")
+	c.Flags().StringVar(&req.textfileOutput, "textfile-output", "", "Also write the result as Prometheus metrics to this file, for the node_exporter textfile collector")
+	c.Flags().StringVar(&req.outputFormat, "output-format", "text", "Format of the check result, json including the details of API errors, icinga2 quoting the performance data labels. [Values: text, json, icinga2]")
+	c.Flags().StringVar(&req.logFormat, "log-format", "text", "Format of the diagnostic logs written to stderr, json adding the pod, container and step fields. [Values: text, json]")
+	c.Flags().StringVar(&req.outputFile, "output-file", "", "Append the full stdout and stderr of the exec command to this file, with a header identifying the check")
+	c.Flags().BoolVar(&req.trace, "trace", false, "Export OpenTelemetry spans of the config, pod-get and exec phases of the check, propagating the trace context to the API server")
+	c.Flags().StringVar(&req.otlpEndpoint, "otlp-endpoint", "", "OTLP/HTTP endpoint the spans are exported to. [Format: 'http://host:4318'] [Default: OTEL_EXPORTER_OTLP_ENDPOINT]")
+	c.Flags().BoolVar(&req.printKubectl, "print-kubectl", false, "Print the kubectl exec command line equivalent to the exec of the check to stderr, to reproduce it by hand")
+	c.Flags().BoolVar(&req.dumpPod, "dump-pod", false, "Print the pod object as fetched, before exec, to stderr as YAML, to troubleshoot the container and phase resolution")
+	c.Flags().MarkHidden("dump-pod")
+	c.Flags().StringVar(&req.webhookURL, "webhook-url", "", "POST the JSON result of the check to this URL, best effort within 5s, without changing the check status")
+	c.Flags().StringVar(&req.webhookOn, "webhook-on", "all", "Results posted to the webhook. [Values: all, failures-only]")
+	c.Flags().StringVar(&req.cloudEventsSink, "cloudevents-sink", "", "Send the result of the check as a CloudEvent of type "+cloudEventType+", in the structured JSON format, to this HTTP sink, best effort within 5s, without changing the check status")
+	c.Flags().StringVar(&req.auditFile, "audit-file", "", "Append a JSON line recording the identity, pod, command and result of the check to this file")
+	c.Flags().StringVar(&req.resultFile, "append-result-file", "", "Append a JSON line holding the time and the JSON result of the check to this file, to build a history of the check")
+	c.Flags().DurationVar(&req.cacheTTL, "cache-ttl", 0, "Reuse the result of an identical check run less than this duration ago, the result may be stale by up to this duration. [Default: no caching]")
+	c.Flags().IntVar(&req.breakerThreshold, "breaker-threshold", 0, "Fail fast, without connecting to the API server, after this number of consecutive connection failures. [Default: no circuit breaker]")
+	c.Flags().DurationVar(&req.breakerCooldown, "breaker-cooldown", time.Minute, "Duration to fail fast for once the circuit breaker is open, doubled each time the first attempt after it fails again")
+	c.Flags().DurationVar(&req.breakerMaxCooldown, "breaker-max-cooldown", 30*time.Minute, "Maximum duration to fail fast for once the circuit breaker is open")
+	c.Flags().IntVar(&req.maxStreams, "max-concurrent-streams", 0, "Maximum number of exec streams open at once against the API server by the checks of the host, the other checks waiting for a free one within their timeout. Keep it below the exec connections the API server and the kubelets serve, which each kubelet also shares with kubectl exec and the exec probes of its pods. [Default: no limit]")
+
+	c.AddCommand(newBenchmarkCmd(c, &req))
+	c.AddCommand(newListContainersCmd(c, &req))
+	c.AddCommand(newRunCmd(c, &req))
+	c.AddCommand(newSelfTestCmd())
+	c.AddCommand(newSetupTestPodCmd(c, &req))
+	c.AddCommand(newTeardownTestPodCmd(c, &req))
+	c.AddCommand(newValidateCmd(c, &req))
 	return c
 }
 
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFlags(t *testing.T) {
+	c := NewCmd()
+	if err := c.ParseFlags([]string{"--namespace", "test", "--ok-codes", "0,3"}); err != nil {
+		t.Fatal(err)
+	}
+	okCodes, _ := c.Flags().GetIntSlice("ok-codes")
+	if !reflect.DeepEqual(okCodes, []int{0, 3}) {
+		t.Errorf("parsed --ok-codes %v", okCodes)
+	}
+}
+
+func TestEvaluateExec(t *testing.T) {
+	tests := []struct {
+		name     string
+		req      Request
+		exitCode int
+		stdout   string
+		stderr   string
+		status   string
+		reason   string
+	}{
+		{"ok", Request{}, 0, "", "", "0", "ok"},
+		{"bad exit code", Request{}, 1, "", "", "2", "bad-exit-code"},
+		{"ok code", Request{OkCodes: []int{0, 3}}, 3, "", "", "0", "ok"},
+		{"output match", Request{ExpectOutput: []string{"^ready$"}, NormalizeOutput: []string{"trim", "lowercase"}}, 0, " Ready\n", "", "0", "ok"},
+		{"output mismatch", Request{ExpectOutput: []string{"^ready$"}, NormalizeOutput: []string{"trim", "lowercase"}}, 0, "starting\n", "", "2", "output-mismatch"},
+		{"exit code before output", Request{ExpectOutput: []string{"^ready$"}}, 1, "ready", "", "2", "bad-exit-code"},
+		{"ignored exit code", Request{IgnoreExitCode: true}, 7, "", "", "0", "ok"},
+		{"strict stderr", Request{Strict: true}, 0, "", "warning: deprecated\n", "2", "output-mismatch"},
+		{"strict blank stderr", Request{Strict: true}, 0, "", " \n", "0", "ok"},
+		{"status from output", Request{StatusFromOutput: true}, 2, "WARNING\nload is high", "", "1", "status-word"},
+		{"no status in output", Request{StatusFromOutput: true}, 0, "fine", "", "UNKNOWN", "output-mismatch"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status, reason, message, err := evaluateExec(&test.req, test.exitCode, test.stdout, test.stderr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status != test.status || reason != test.reason {
+				t.Errorf("got %v (%v) instead of %v (%v): %v", statusNames[status], reason, statusNames[test.status], test.reason, message)
+			}
+		})
+	}
+}
+
+func TestCollapseRepeatedLines(t *testing.T) {
+	tests := []struct {
+		text      string
+		threshold int
+		want      string
+	}{
+		{"a\na\na\nb", 3, "a (repeated 3 times)\nb"},
+		{"a\na\nb", 3, "a\na\nb"},
+		{"a\nb\nb\nb\nb\na", 3, "a\nb (repeated 4 times)\na"},
+		{"a\na", 2, "a (repeated 2 times)"},
+		{"", 3, ""},
+	}
+	for _, test := range tests {
+		if got := collapseRepeatedLines(test.text, test.threshold); got != test.want {
+			t.Errorf("collapseRepeatedLines(%q, %v) = %q, want %q", test.text, test.threshold, got, test.want)
+		}
+	}
+}
+
+func TestCommandOutputBinary(t *testing.T) {
+	if output := commandOutput(&Request{}, "\x00\xff", ""); !strings.Contains(output, "<binary output, 2 bytes>") {
+		t.Errorf("binary output shown as %q", output)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// checkNamespaceExists fails if the namespace of the request does not exist,
+// to report it instead of a missing pod.
+func checkNamespaceExists(ctx context.Context, kubeClient *kubernetes.Clientset, req *Request) error {
+	_, err := kubeClient.CoreV1().Namespaces().Get(ctx, req.Namespace, metav1.GetOptions{})
+	if isNotFound(err) {
+		return withReason("not-found", fmt.Errorf(`Namespace "%v" does not exist`, req.Namespace))
+	}
+	if err != nil {
+		return fmt.Errorf(`Failed to get namespace "%v": %w`, req.Namespace, err)
+	}
+	return nil
+}
+
+// checkNamespaces runs the check in each of the namespaces of the request and
+// aggregates the results to the worst status, as checkPods does for the pods
+// of a namespace. Only the pods of these namespaces are listed, which does not
+// require a cluster-wide permission.
+func checkNamespaces(ctx context.Context, req *Request) *Result {
+	worst, reason := "0", "ok"
+	var failed, details []string
+	var results []Result
+	var timings Timings
+	start := time.Now()
+	for i, namespace := range req.Namespaces {
+		if i > 0 {
+			waitDelay(ctx, req.Delay)
+		}
+		setLogField("namespace", namespace)
+		namespaceReq := *req
+		namespaceReq.Namespace, namespaceReq.Namespaces = namespace, nil
+		result := checkKubeExec(ctx, &namespaceReq)
+		results = append(results, result.records()...)
+		timings.Config += result.Timings.Config
+		timings.PodGet += result.Timings.PodGet
+		timings.Exec += result.Timings.Exec
+		if statusSeverity[result.Status] > statusSeverity[worst] {
+			worst, reason = result.Status, result.Reason
+		}
+
+		message := strings.SplitN(result.Message, " | ", 2)[0]
+		details = append(details, fmt.Sprintf("%v: %v - %v", namespace, statusNames[result.Status], message))
+		if result.Status != "0" {
+			failed = append(failed, fmt.Sprintf("%v(%v)", namespace, statusNames[result.Status]))
+		}
+	}
+	setLogField("namespace", "")
+
+	elapsed := time.Since(start)
+	result := &Result{
+		Status:    worst,
+		ExitCode:  -1,
+		Duration:  elapsed,
+		Timings:   timings,
+		Namespace: strings.Join(req.Namespaces, ","),
+		Reason:    reason,
+		results:   results,
+	}
+	summary := fmt.Sprintf("%v/%v namespaces failed", len(failed), len(req.Namespaces))
+	perfData := fmt.Sprintf("ok=%v fail=%v batch_time=%.3fs", len(req.Namespaces)-len(failed), len(failed), elapsed.Seconds())
+	if req.Compact {
+		if len(failed) > 0 {
+			summary = fmt.Sprintf("%v: %v", summary, strings.Join(failed, ", "))
+		}
+		result.Message = fmt.Sprintf("%v | %v", summary, perfData)
+		return result
+	}
+	result.Message = fmt.Sprintf("%v | %v\n%v", summary, perfData, strings.Join(details, "\n"))
+	return result
+}
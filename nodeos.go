@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// windowsShells maps the Windows shells to the flag running their command
+// argument.
+var windowsShells = map[string]string{
+	"cmd":            "/c",
+	"cmd.exe":        "/c",
+	"powershell":     "-Command",
+	"powershell.exe": "-Command",
+	"pwsh":           "-Command",
+}
+
+// windowsShell replaces a Linux shell on Windows nodes.
+const windowsShell = "cmd"
+
+// detectOS returns the operating system of the pod: from its spec if set,
+// else from its kubernetes.io/os node selector, else, if readNode is set,
+// from the kubernetes.io/os label of its node. It defaults to linux, in
+// particular when the node can't be read.
+func detectOS(ctx context.Context, kubeClient *kubernetes.Clientset, pod *corev1.Pod, readNode bool) string {
+	if pod.Spec.OS != nil && pod.Spec.OS.Name != "" {
+		return string(pod.Spec.OS.Name)
+	}
+	if name := pod.Spec.NodeSelector[corev1.LabelOSStable]; name != "" {
+		return name
+	}
+	if !readNode || pod.Spec.NodeName == "" {
+		return "linux"
+	}
+	node, err := kubeClient.CoreV1().Nodes().Get(ctx, pod.Spec.NodeName, metav1.GetOptions{})
+	if err != nil {
+		log.Printf(`Failed to get node "%v", assuming linux: %v`, pod.Spec.NodeName, err)
+		return "linux"
+	}
+	if name := node.Labels[corev1.LabelOSStable]; name != "" {
+		return name
+	}
+	return "linux"
+}
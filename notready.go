@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// isPodReady reports whether the Ready condition of the pod is True.
+func isPodReady(pod *corev1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// tolerateNotReady reports the result of the check of a pod which is running
+// but not ready, e.g. still starting up, as WARNING whatever its status, so
+// that a startup window does not raise a false alert.
+func tolerateNotReady(pod *corev1.Pod, result Result) Result {
+	parts := strings.SplitN(result.Message, " | ", 2)
+	parts[0] = fmt.Sprintf(`Pod "%v" is not ready: %v - %v`, pod.Name, statusNames[result.Status], parts[0])
+	result.Message = strings.Join(parts, " | ")
+	result.Status, result.Reason = "1", "not-running"
+	return result
+}
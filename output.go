@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+)
+
+// outputFormats formats the check result printed on stdout, by format name.
+var outputFormats = map[string]func(r *Result) (string, error){
+	"text": func(r *Result) (string, error) {
+		return r.String(), nil
+	},
+	"json": func(r *Result) (string, error) {
+		data, err := json.Marshal(r)
+		return string(data), err
+	},
+	"icinga2": formatIcinga2,
+}
+
+// perfValue matches a performance data value with its unit of measurement
+// and thresholds, "U" being an undetermined value.
+var perfValue = regexp.MustCompile(`^(U|[-+]?[0-9.]+(?:[eE][-+]?[0-9]+)?[a-zA-Z%]*)(;.*)?$`)
+
+// formatIcinga2 formats the result as Icinga 2 expects it: the performance
+// data always on the first line after " | ", with single quoted labels and
+// the value units, the other lines being the long output. Malformed items
+// are dropped, as Icinga 2 would discard the whole performance data.
+func formatIcinga2(r *Result) (string, error) {
+	lines := strings.SplitN(r.Message, "\n", 2)
+	text, perf := lines[0], ""
+	if i := strings.Index(text, "|"); i >= 0 {
+		text, perf = strings.TrimSpace(text[:i]), text[i+1:]
+	}
+
+	var perfData []string
+	for _, item := range strings.Fields(perf) {
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 || !perfValue.MatchString(kv[1]) {
+			log.Printf(`Dropping invalid performance data "%v"`, item)
+			continue
+		}
+		label := strings.Trim(kv[0], "'")
+		perfData = append(perfData, fmt.Sprintf("'%v'=%v", strings.Replace(label, "'", "''", -1), kv[1]))
+	}
+
+	output := fmt.Sprintf("%v - %v", statusNames[r.Status], text)
+	if len(perfData) > 0 {
+		output = fmt.Sprintf("%v | %v", output, strings.Join(perfData, " "))
+	}
+	if len(lines) == 2 {
+		output = fmt.Sprintf("%v\n%v", output, lines[1])
+	}
+	return output, nil
+}
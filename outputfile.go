@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	utilexec "k8s.io/client-go/util/exec"
+)
+
+// writeOutputFile appends the full output of an exec to the output file, for
+// later inspection of intermittent failures. Each exec is preceded by a
+// header with its time, pod, container, command and result, and by its stdin
+// as sent, base64 encoded if binary. Failures are only logged, they don't
+// change the check result.
+func writeOutputFile(req *Request, pod, container string, command, stdinLines []string, stdout, stderr string, execErr error) {
+	result := "exit code 0"
+	if exitErr, ok := execErr.(utilexec.ExitError); ok && exitErr.Exited() {
+		result = fmt.Sprintf("exit code %v", exitErr.ExitStatus())
+	} else if execErr != nil {
+		result = fmt.Sprintf("error: %v", execErr)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "=== %v %v/%v container %v: %v (%v)\n", time.Now().Format(time.RFC3339),
+		req.Namespace, pod, container, strings.Join(command, " "), result)
+	if len(stdinLines) > 0 {
+		stdin := strings.Join(stdinLines, stdinSeparators[req.StdinSeparator])
+		if isBinaryOutput(stdin) {
+			fmt.Fprintf(&buf, "--- stdin (base64)\n%v\n", base64.StdEncoding.EncodeToString([]byte(stdin)))
+		} else {
+			fmt.Fprintf(&buf, "--- stdin\n%v\n", stdin)
+		}
+	}
+	if req.CombineOutput {
+		fmt.Fprintf(&buf, "--- output\n%v\n", stdout)
+	} else {
+		fmt.Fprintf(&buf, "--- stdout\n%v\n--- stderr\n%v\n", stdout, stderr)
+	}
+
+	file, err := os.OpenFile(req.outputFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err == nil {
+		_, err = file.Write(buf.Bytes())
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		log.Printf("Failed to write output file: %v", err)
+	}
+}
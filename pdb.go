@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// podDisruptionBudgets returns the summaries of the PodDisruptionBudgets
+// whose selector matches the pod.
+func podDisruptionBudgets(ctx context.Context, kubeClient *kubernetes.Clientset, pod *corev1.Pod) ([]string, error) {
+	list, err := kubeClient.PolicyV1().PodDisruptionBudgets(pod.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf(`Failed to list PodDisruptionBudgets of pod "%v": %w`, pod.Name, err)
+	}
+
+	var summaries []string
+	for _, pdb := range list.Items {
+		selector, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+		if err != nil {
+			log.Printf(`Invalid selector of PodDisruptionBudget "%v": %v`, pdb.Name, err)
+			continue
+		}
+		// an empty selector matches no pod in policy/v1
+		if selector.Empty() || !selector.Matches(labels.Set(pod.Labels)) {
+			continue
+		}
+		summaries = append(summaries, fmt.Sprintf(`"%v" allows %v disruptions (%v/%v healthy)`,
+			pdb.Name, pdb.Status.DisruptionsAllowed, pdb.Status.CurrentHealthy, pdb.Status.ExpectedPods))
+	}
+	return summaries, nil
+}
+
+// addPDB adds the disruption status of the PodDisruptionBudgets covering the
+// pod to the output, which tells whether a failure during a maintenance was
+// expected.
+func addPDB(ctx context.Context, kubeClient *kubernetes.Clientset, pod *corev1.Pod, result Result) Result {
+	summaries, err := podDisruptionBudgets(ctx, kubeClient, pod)
+	if err != nil {
+		log.Print(err)
+		return result
+	}
+	if len(summaries) == 0 {
+		return appendOutput(result, "no PodDisruptionBudget")
+	}
+	return appendOutput(result, "PodDisruptionBudget "+strings.Join(summaries, "; "))
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+var podPhases = []corev1.PodPhase{
+	corev1.PodPending,
+	corev1.PodRunning,
+	corev1.PodSucceeded,
+	corev1.PodFailed,
+	corev1.PodUnknown,
+}
+
+// normalizePhases validates the allowed phases, given in any case, and
+// returns their canonical names.
+func normalizePhases(phases []string) ([]string, error) {
+	normalized := make([]string, 0, len(phases))
+phases:
+	for _, phase := range phases {
+		for _, podPhase := range podPhases {
+			if strings.EqualFold(phase, string(podPhase)) {
+				normalized = append(normalized, string(podPhase))
+				continue phases
+			}
+		}
+		return nil, fmt.Errorf(`Unsupported pod phase "%v" [Values: Pending, Running, Succeeded, Failed, Unknown]`, phase)
+	}
+	return normalized, nil
+}
+
+// isAllowedPhase reports whether the pod may be checked in its phase: one of
+// the allowed phases if any, else Running.
+func isAllowedPhase(pod *corev1.Pod, req *Request) bool {
+	if len(req.AllowedPhases) == 0 {
+		return pod.Status.Phase == corev1.PodRunning
+	}
+	for _, phase := range req.AllowedPhases {
+		if string(pod.Status.Phase) == phase {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPodPhase asserts that the pod is in one of the allowed phases, the
+// check being CRITICAL otherwise. A running pod is checked by exec, while
+// another allowed phase is OK without exec since its containers are not
+// running.
+func checkPodPhase(pod *corev1.Pod, req *Request) (string, interface{}, bool) {
+	allowed := strings.Join(req.AllowedPhases, ", ")
+	if !isAllowedPhase(pod, req) {
+		return "2", fmt.Sprintf(`Pod "%v" phase %v is not one of the allowed phases: %v`, pod.Name, pod.Status.Phase, allowed), false
+	}
+	if pod.Status.Phase != corev1.PodRunning {
+		return "0", fmt.Sprintf(`Pod "%v" phase %v is allowed: %v`, pod.Name, pod.Status.Phase, allowed), false
+	}
+	return "0", nil, true
+}
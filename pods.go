@@ -0,0 +1,374 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/yaml"
+)
+
+// getPods fetches the pods to check: by name, by IP, or by selector. Unless
+// all pods are checked, a single pod is returned.
+func getPods(ctx context.Context, kubeClient *kubernetes.Clientset, req *Request) ([]*corev1.Pod, error) {
+	switch {
+	case req.PodIP != "":
+		pod, err := getPodByIP(ctx, kubeClient, req)
+		if err != nil {
+			return nil, err
+		}
+		return []*corev1.Pod{pod}, nil
+	case req.StatefulSet != "":
+		pod, err := getStatefulSetPod(ctx, kubeClient, req)
+		if err != nil {
+			return nil, err
+		}
+		return []*corev1.Pod{pod}, nil
+	case req.Selector != "" || req.AllPods:
+		return getPodsBySelector(ctx, kubeClient, req, "")
+	default:
+		pod, err := kubeClient.CoreV1().Pods(req.Namespace).Get(ctx, req.Pod, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf(`Failed to get pod "%v": %w`, req.Pod, err)
+		}
+		return []*corev1.Pod{pod}, nil
+	}
+}
+
+func getPodByIP(ctx context.Context, kubeClient *kubernetes.Clientset, req *Request) (*corev1.Pod, error) {
+	pods, err := kubeClient.CoreV1().Pods(req.Namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: "status.podIP=" + req.PodIP,
+	})
+	if err != nil {
+		return nil, fmt.Errorf(`Failed to list pods with IP "%v": %w`, req.PodIP, err)
+	}
+	var matches []*corev1.Pod
+	for i := range pods.Items {
+		if pods.Items[i].Status.PodIP == req.PodIP {
+			matches = append(matches, &pods.Items[i])
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, withReason("not-found", fmt.Errorf(`No pod with IP "%v" in namespace "%v"`, req.PodIP, req.Namespace))
+	case 1:
+		log.Printf(`Pod "%v" has IP "%v"`, matches[0].Name, req.PodIP)
+		return matches[0], nil
+	default:
+		return nil, fmt.Errorf(`%v pods with IP "%v": %v`, len(matches), req.PodIP, podNames(matches))
+	}
+}
+
+// getStatefulSetPod fetches the StatefulSet replica with the requested
+// ordinal, which must be lower than the current replica count.
+func getStatefulSetPod(ctx context.Context, kubeClient *kubernetes.Clientset, req *Request) (*corev1.Pod, error) {
+	sts, err := kubeClient.AppsV1().StatefulSets(req.Namespace).Get(ctx, req.StatefulSet, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf(`Failed to get StatefulSet "%v": %w`, req.StatefulSet, err)
+	}
+	replicas := int32(1)
+	if sts.Spec.Replicas != nil {
+		replicas = *sts.Spec.Replicas
+	}
+	if req.Ordinal < 0 || int32(req.Ordinal) >= replicas {
+		return nil, fmt.Errorf(`Ordinal %v out of range, StatefulSet "%v" has %v replicas`, req.Ordinal, sts.Name, replicas)
+	}
+
+	name := fmt.Sprintf("%v-%v", sts.Name, req.Ordinal)
+	pod, err := kubeClient.CoreV1().Pods(req.Namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf(`Failed to get pod "%v": %w`, name, err)
+	}
+	return pod, nil
+}
+
+// podPageSize is the number of pods listed per request, which bounds the
+// memory and the API server load in namespaces with thousands of pods.
+const podPageSize = 500
+
+// listPods lists the pods matching the selector page by page, calling fn for
+// each pod until it returns false.
+func listPods(ctx context.Context, kubeClient *kubernetes.Clientset, req *Request, fn func(pod *corev1.Pod) bool) error {
+	opts := metav1.ListOptions{LabelSelector: req.Selector, Limit: podPageSize}
+	for {
+		list, err := kubeClient.CoreV1().Pods(req.Namespace).List(ctx, opts)
+		if err != nil {
+			return fmt.Errorf(`Failed to list pods matching "%v": %w`, req.Selector, err)
+		}
+		for i := range list.Items {
+			if !fn(&list.Items[i]) {
+				return nil
+			}
+		}
+		if list.Continue == "" {
+			return nil
+		}
+		opts.Continue = list.Continue
+	}
+}
+
+// getPodsBySelector lists the pods matching the selector: all of them when
+// checking all pods, else the first, or newest, running one, or in an allowed
+// phase, which is not excluded, with the pod template hash if any. The listing
+// stops at the first such pod when it is enough.
+func getPodsBySelector(ctx context.Context, kubeClient *kubernetes.Clientset, req *Request, exclude string) ([]*corev1.Pod, error) {
+	firstMatch := !req.AllPods && !req.Newest && !req.ExpectSingle && req.PodTemplateHash == ""
+	var pods []*corev1.Pod
+	matched, owned := 0, 0
+	err := listPods(ctx, kubeClient, req, func(pod *corev1.Pod) bool {
+		matched++
+		if !isOwnedBy(pod, req) {
+			return true
+		}
+		owned++
+		if !hasTemplateHash(pod, req) {
+			return true
+		}
+		pods = append(pods, pod)
+		return !firstMatch || !isAllowedPhase(pod, req) || (req.TolerateNotReady && !isPodReady(pod)) || pod.Name == exclude
+	})
+	if err != nil {
+		return nil, err
+	}
+	if matched == 0 {
+		return nil, withReason("not-found", fmt.Errorf(`No pod matches "%v" in namespace "%v"`, req.Selector, req.Namespace))
+	}
+	if owned == 0 {
+		return nil, withReason("not-found", fmt.Errorf(`No pod of ReplicaSet "%v" matches "%v" in namespace "%v"`, req.ReplicaSet, req.Selector, req.Namespace))
+	}
+	if req.PodTemplateHash != "" {
+		if len(pods) == 0 {
+			return nil, withReason("not-found", fmt.Errorf(`None of the %v pods matching "%v" has pod-template-hash "%v"`, owned, req.Selector, req.PodTemplateHash))
+		}
+		log.Printf(`%v of the %v pods matching "%v" have pod-template-hash "%v": %v`,
+			len(pods), owned, req.Selector, req.PodTemplateHash, podNames(pods))
+	}
+	if req.AllPods {
+		return pods, nil
+	}
+	if req.ExpectSingle && len(pods) > 1 {
+		return nil, fmt.Errorf(`%v pods match "%v", expected a single one: %v`, len(pods), req.Selector, podNames(pods))
+	}
+
+	if req.Newest {
+		sort.SliceStable(pods, func(i, j int) bool {
+			return podStartTime(pods[i]).After(podStartTime(pods[j]))
+		})
+	}
+	for _, pod := range pods {
+		if isAllowedPhase(pod, req) && pod.Name != exclude && (!req.TolerateNotReady || isPodReady(pod)) {
+			if req.Newest {
+				log.Printf(`Pod "%v" is the newest matching "%v", started %v ago`,
+					pod.Name, req.Selector, time.Since(podStartTime(pod)).Round(time.Second))
+			} else {
+				log.Printf(`Pod "%v" matches "%v"`, pod.Name, req.Selector)
+			}
+			return []*corev1.Pod{pod}, nil
+		}
+	}
+	if req.TolerateNotReady {
+		for _, pod := range pods {
+			if pod.Status.Phase == corev1.PodRunning && pod.Name != exclude {
+				log.Printf(`No ready pod matches "%v", checking pod "%v" which is running but not ready`, req.Selector, pod.Name)
+				return []*corev1.Pod{pod}, nil
+			}
+		}
+	}
+	if len(req.AllowedPhases) > 0 {
+		return nil, withReason("not-running", fmt.Errorf(`No pod in phase %v matches "%v" in namespace "%v"`, strings.Join(req.AllowedPhases, ", "), req.Selector, req.Namespace))
+	}
+	return nil, withReason("not-running", fmt.Errorf(`No running pod matches "%v" in namespace "%v"`, req.Selector, req.Namespace))
+}
+
+// podStartTime returns the start time of the pod, or its creation time if it
+// has not started yet.
+func podStartTime(pod *corev1.Pod) time.Time {
+	if pod.Status.StartTime != nil {
+		return pod.Status.StartTime.Time
+	}
+	return pod.CreationTimestamp.Time
+}
+
+// isNotFound reports whether the error is caused by a missing API object,
+// such as a pod deleted during the check.
+func isNotFound(err error) bool {
+	var status apierrors.APIStatus
+	return errors.As(err, &status) && status.Status().Reason == metav1.StatusReasonNotFound
+}
+
+func podNames(pods []*corev1.Pod) string {
+	names := make([]string, len(pods))
+	for i, pod := range pods {
+		names[i] = pod.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// dumpPod prints the pod as fetched to stderr as YAML, to troubleshoot the
+// container and phase resolution against the exact object state checked.
+func dumpPod(pod *corev1.Pod) {
+	dump := pod.DeepCopy()
+	dump.APIVersion, dump.Kind = "v1", "Pod"
+	data, err := yaml.Marshal(dump)
+	if err != nil {
+		log.Printf(`Failed to dump pod "%v": %v`, pod.Name, err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "---\n%s", data)
+}
+
+// statusSeverity orders the statuses to aggregate the results of several
+// pods to the worst one.
+var statusSeverity = map[string]int{
+	"0":       0,
+	"1":       1,
+	"UNKNOWN": 2,
+	"2":       3,
+}
+
+// checkPods runs the check against every pod and aggregates the results to
+// the worst status. The output lists the result of each pod, or only the
+// failed pods on a single line in compact mode. With fail fast, the first
+// CRITICAL pod skips the remaining ones. Once ctx is done, the remaining pods
+// are UNKNOWN without being checked. The pods are checked by as many workers
+// as podWorkers returns, the results being reported in the order of the pods.
+func checkPods(ctx context.Context, config *rest.Config, kubeClient *kubernetes.Clientset, req *Request, pods []*corev1.Pod, timings Timings) *Result {
+	worst, reason := "0", "ok"
+	var failed, details []string
+	var unchecked int
+	results := make([]Result, 0, len(pods))
+	start := time.Now()
+	check := func(pod *corev1.Pod) (Result, bool) {
+		if ctx.Err() != nil {
+			// past the deadline, the remaining pods are reported as not
+			// checked, next to the results gathered so far
+			result := Result{Status: "UNKNOWN", ExitCode: -1, Pod: pod.Name, Namespace: req.Namespace}
+			result.setOutput(fmt.Errorf("Not checked: %w", ctx.Err()))
+			return result, false
+		}
+		result := checkPod(ctx, config, kubeClient, req, pod, timings)
+		if req.ShowEvents && result.Status != "0" {
+			result = addEvents(ctx, kubeClient, req, result)
+		}
+		if req.ShowPDB {
+			result = addPDB(ctx, kubeClient, pod, result)
+		}
+		if req.EmitEvent && result.Status != "0" {
+			emitEvent(ctx, kubeClient, pod, result)
+		}
+		return result, true
+	}
+
+	workers := podWorkers(req, len(pods))
+	var concurrent []Result
+	var ran []bool
+	if workers > 1 {
+		concurrent, ran = make([]Result, len(pods)), make([]bool, len(pods))
+		forEachPod(len(pods), workers, func(i int) {
+			concurrent[i], ran[i] = check(pods[i])
+		})
+	}
+	for i, pod := range pods {
+		var result Result
+		var checked bool
+		if workers > 1 {
+			result, checked = concurrent[i], ran[i]
+		} else {
+			if i > 0 {
+				waitDelay(ctx, req.Delay)
+			}
+			result, checked = check(pod)
+		}
+		if !checked {
+			unchecked++
+		}
+		results = append(results, result)
+		if statusSeverity[result.Status] > statusSeverity[worst] {
+			worst, reason = result.Status, result.Reason
+		}
+
+		// the performance data of each pod is dropped as it would be
+		// mixed up with the one of the other pods
+		message := strings.SplitN(result.Message, " | ", 2)[0]
+		details = append(details, fmt.Sprintf("%v: %v - %v", pod.Name, statusNames[result.Status], message))
+		if result.Status == "0" {
+			continue
+		}
+		if result.ExitCode >= 0 {
+			failed = append(failed, fmt.Sprintf("%v(exit %v)", pod.Name, result.ExitCode))
+		} else {
+			failed = append(failed, fmt.Sprintf("%v(%v)", pod.Name, statusNames[result.Status]))
+		}
+		if req.FailFast && result.Status == "2" {
+			break
+		}
+	}
+
+	batch := time.Since(start)
+	result := &Result{
+		Status:    worst,
+		ExitCode:  -1,
+		Duration:  timings.Config + timings.PodGet + batch,
+		Timings:   Timings{Config: timings.Config, PodGet: timings.PodGet, Exec: batch},
+		Namespace: req.Namespace,
+		Reason:    reason,
+		results:   results,
+	}
+	summary := fmt.Sprintf("%v/%v pods failed", len(failed), len(pods))
+	if skipped := len(pods) - len(results); skipped > 0 {
+		summary = fmt.Sprintf("%v, %v skipped after the first CRITICAL", summary, skipped)
+	}
+	if unchecked > 0 {
+		summary = fmt.Sprintf("%v, %v not checked: %v", summary, unchecked, ctx.Err())
+	}
+	perfData := fmt.Sprintf("ok=%v fail=%v batch_time=%.3fs", len(results)-len(failed), len(failed), batch.Seconds())
+	if req.Compact {
+		if len(failed) > 0 {
+			summary = fmt.Sprintf("%v: %v", summary, strings.Join(failed, ", "))
+		}
+		result.Message = fmt.Sprintf("%v |%v", summary, perfData)
+		return result
+	}
+	result.Message = fmt.Sprintf("%v | %v\n%v", summary, perfData, strings.Join(details, "\n"))
+	return result
+}
+
+// waitDelay waits for the delay between two execs of a batch, returning early
+// once ctx is done so that the remaining checks abort promptly.
+func waitDelay(ctx context.Context, delay time.Duration) {
+	if delay <= 0 {
+		return
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+// maxRetryBackoff caps the exponential backoff between retries.
+const maxRetryBackoff = 30 * time.Second
+
+// retryBackoff returns the delay before the retry following the given
+// attempt, doubling the base delay at each attempt.
+func retryBackoff(base time.Duration, attempt int) time.Duration {
+	delay := base
+	for i := 1; i < attempt && delay < maxRetryBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryBackoff {
+		return maxRetryBackoff
+	}
+	return delay
+}
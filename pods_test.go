@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// testPods returns the pods given as "name=version", labelled with their
+// version, the ones named with a "terminating" prefix being deleted.
+func testPods(specs ...string) []*corev1.Pod {
+	var pods []*corev1.Pod
+	for _, spec := range specs {
+		kv := strings.SplitN(spec, "=", 2)
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: kv[0], Labels: map[string]string{"version": kv[1]}}}
+		if strings.HasPrefix(kv[0], "terminating") {
+			pod.DeletionTimestamp = &metav1.Time{}
+		}
+		pods = append(pods, pod)
+	}
+	return pods
+}
+
+func TestCheckPods(t *testing.T) {
+	tests := []struct {
+		name   string
+		req    Request
+		pods   []string
+		status string
+		failed string
+	}{
+		{"all ok", Request{}, []string{"web-1=v1", "web-2=v1"}, "0", "0/2 pods failed"},
+		{"one critical", Request{}, []string{"web-1=v1", "web-2=v2"}, "2", "1/2 pods failed"},
+		{"unknown", Request{TerminatingStatus: "UNKNOWN"}, []string{"web-1=v1", "terminating-1=v1"}, "UNKNOWN", "1/2 pods failed"},
+		{"critical over unknown", Request{TerminatingStatus: "UNKNOWN"}, []string{"terminating-1=v1", "web-1=v2"}, "2", "2/2 pods failed"},
+		{"warning", Request{TerminatingStatus: "WARNING"}, []string{"terminating-1=v1", "web-1=v1"}, "1", "1/2 pods failed"},
+		{"sequential", Request{Concurrency: 1}, []string{"web-1=v2", "web-2=v1", "web-3=v1"}, "2", "1/3 pods failed"},
+		{"fail fast", Request{FailFast: true}, []string{"web-1=v1", "web-2=v2", "web-3=v2"}, "2", "1/3 pods failed, 1 skipped"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.req.ExpectLabel = "version=v1"
+			result := checkPods(context.Background(), nil, nil, &test.req, testPods(test.pods...), Timings{})
+			if result.Status != test.status || !strings.HasPrefix(result.Message, test.failed) {
+				t.Errorf("got %v: %v, want %v: %v", statusNames[result.Status], result.Message, statusNames[test.status], test.failed)
+			}
+		})
+	}
+}
+
+func TestCheckPodsOrder(t *testing.T) {
+	pods := testPods("web-3=v1", "web-1=v2", "web-2=v1")
+	result := checkPods(context.Background(), nil, nil, &Request{ExpectLabel: "version=v1", Concurrency: 3}, pods, Timings{})
+	lines := strings.Split(result.Message, "\n")[1:]
+	if len(lines) != len(pods) {
+		t.Fatalf("reported %v results for %v pods: %v", len(lines), len(pods), result.Message)
+	}
+	for i, line := range lines {
+		if !strings.HasPrefix(line, pods[i].Name+": ") {
+			t.Errorf("result %v is %q instead of the one of pod %v", i, line, pods[i].Name)
+		}
+	}
+}
+
+func TestCheckPodsDeadline(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	result := checkPods(ctx, nil, nil, &Request{ExpectLabel: "version=v1"}, testPods("web-1=v1", "web-2=v1"), Timings{})
+	if result.Status != "UNKNOWN" || !strings.Contains(result.Message, "2 not checked") {
+		t.Errorf("got %v: %v, want UNKNOWN with the pods not checked", statusNames[result.Status], result.Message)
+	}
+	for _, name := range []string{"web-1", "web-2"} {
+		if !strings.Contains(result.Message, "\n"+name+": UNKNOWN - Not checked") {
+			t.Errorf("pod %v not reported as not checked: %v", name, result.Message)
+		}
+	}
+}
+
+func TestCheckPodsCompact(t *testing.T) {
+	result := checkPods(context.Background(), nil, nil, &Request{ExpectLabel: "version=v1", Compact: true}, testPods("web-1=v2"), Timings{})
+	if strings.Contains(result.Message, "\n") || !strings.Contains(result.Message, "web-1(CRITICAL)") {
+		t.Errorf("compact output %q", result.Message)
+	}
+}
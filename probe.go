@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// auditsProbes reports whether the check audits the container probes instead
+// of running exec.
+func (req *Request) auditsProbes() bool {
+	return req.ExpectLivenessPath != "" || req.ExpectReadinessPath != ""
+}
+
+// checkProbes audits, from the pod spec and without running exec, that the
+// HTTP paths of the container liveness and readiness probes are the expected
+// ones. It warns about a missing or changed probe.
+func checkProbes(container *corev1.Container, req *Request) (string, interface{}) {
+	probes := []struct {
+		kind, expectPath string
+		probe            *corev1.Probe
+	}{
+		{"liveness", req.ExpectLivenessPath, container.LivenessProbe},
+		{"readiness", req.ExpectReadinessPath, container.ReadinessProbe},
+	}
+
+	var found, mismatches []string
+	for _, p := range probes {
+		if p.expectPath == "" {
+			continue
+		}
+		switch {
+		case p.probe == nil:
+			mismatches = append(mismatches, fmt.Sprintf("no %v probe", p.kind))
+		case p.probe.HTTPGet == nil:
+			mismatches = append(mismatches, fmt.Sprintf("%v probe is not an HTTP GET", p.kind))
+		case p.probe.HTTPGet.Path != p.expectPath:
+			mismatches = append(mismatches, fmt.Sprintf(`%v probe path "%v" is not "%v"`, p.kind, p.probe.HTTPGet.Path, p.expectPath))
+		default:
+			found = append(found, fmt.Sprintf(`%v probe path "%v"`, p.kind, p.probe.HTTPGet.Path))
+		}
+	}
+
+	if len(mismatches) > 0 {
+		return "1", fmt.Sprintf(`Container "%v" probes changed: %v`, container.Name, strings.Join(mismatches, ", "))
+	}
+	return "0", fmt.Sprintf(`Container "%v" has %v`, container.Name, strings.Join(found, ", "))
+}
+
+// containerProbe returns the probe of the given type of the container.
+func containerProbe(container *corev1.Container, probeType string) *corev1.Probe {
+	switch probeType {
+	case "liveness":
+		return container.LivenessProbe
+	case "readiness":
+		return container.ReadinessProbe
+	case "startup":
+		return container.StartupProbe
+	}
+	return nil
+}
+
+// runProbe runs the exec command of the container probe as the kubelet does,
+// without a shell and within the probe timeout, and reports whether the probe
+// passes: it fails on a non-zero exit code or a timeout. The reason of the
+// result is returned with its status.
+func runProbe(ctx context.Context, config *rest.Config, kubeClient *kubernetes.Clientset, req *Request, pod string, container *corev1.Container) (string, string, interface{}) {
+	probe := containerProbe(container, req.ProbeType)
+	if probe == nil {
+		return "UNKNOWN", "not-found", fmt.Errorf(`Container "%v" has no %v probe`, container.Name, req.ProbeType)
+	}
+	if probe.Exec == nil || len(probe.Exec.Command) == 0 {
+		return "UNKNOWN", "config", fmt.Errorf(`Container "%v" %v probe is not an exec probe`, container.Name, req.ProbeType)
+	}
+
+	// the kubelet defaults the probe timeout to 1 second
+	timeout := time.Second
+	if probe.TimeoutSeconds > 0 {
+		timeout = time.Duration(probe.TimeoutSeconds) * time.Second
+	}
+	probeCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	name := strings.ToUpper(req.ProbeType[:1]) + req.ProbeType[1:]
+	command := probe.Exec.Command
+	exitCode, stdout, stderr, err := execCommand(probeCtx, config, kubeClient, req, pod, container.Name, command, nil)
+	switch {
+	case err != nil && ctx.Err() == nil && errors.Is(probeCtx.Err(), context.DeadlineExceeded):
+		return "2", "timeout", fmt.Sprintf(`%v probe "%v" timed out after %v`, name, strings.Join(command, " "), timeout)
+	case err != nil:
+		return "UNKNOWN", "", err
+	case exitCode != 0:
+		output := strings.TrimSpace(stdout + stderr)
+		if len(output) > 200 {
+			output = output[:200]
+		}
+		return "2", "bad-exit-code", fmt.Sprintf(`%v probe "%v" failed, Exit Code: %v, output: "%v"`, name, strings.Join(command, " "), exitCode, output)
+	}
+	return "0", "ok", fmt.Sprintf(`%v probe "%v" passed`, name, strings.Join(command, " "))
+}
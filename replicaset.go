@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const revisionAnnotation = "deployment.kubernetes.io/revision"
+
+// resolveReplicaSet fetches the ReplicaSet and sets the selector of the
+// request to its one, the pods being then filtered on their controller owner
+// reference so that only the pods of this revision are checked.
+func resolveReplicaSet(ctx context.Context, kubeClient *kubernetes.Clientset, req *Request) (*appsv1.ReplicaSet, error) {
+	rs, err := kubeClient.AppsV1().ReplicaSets(req.Namespace).Get(ctx, req.ReplicaSet, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf(`Failed to get ReplicaSet "%v": %w`, req.ReplicaSet, err)
+	}
+	selector, err := metav1.LabelSelectorAsSelector(rs.Spec.Selector)
+	if err != nil {
+		return nil, fmt.Errorf(`Invalid selector of ReplicaSet "%v": %w`, req.ReplicaSet, err)
+	}
+	req.Selector = selector.String()
+	req.ownerUID = rs.UID
+	log.Printf(`ReplicaSet "%v" selects "%v"`, rs.Name, req.Selector)
+	return rs, nil
+}
+
+// isOwnedBy reports whether the pod is controlled by the ReplicaSet of the
+// request, if any.
+func isOwnedBy(pod *corev1.Pod, req *Request) bool {
+	if req.ownerUID == "" {
+		return true
+	}
+	owner := metav1.GetControllerOf(pod)
+	return owner != nil && owner.UID == req.ownerUID
+}
+
+// hasTemplateHash reports whether the pod has the pod template hash label of
+// the request, if any.
+func hasTemplateHash(pod *corev1.Pod, req *Request) bool {
+	return req.PodTemplateHash == "" || pod.Labels[appsv1.DefaultDeploymentUniqueLabelKey] == req.PodTemplateHash
+}
+
+// replicaSetRevision describes the revision of the ReplicaSet, from the
+// deployment revision annotation and the pod template hash label.
+func replicaSetRevision(rs *appsv1.ReplicaSet) string {
+	revision := fmt.Sprintf(`ReplicaSet "%v"`, rs.Name)
+	if value, ok := rs.Annotations[revisionAnnotation]; ok {
+		revision = fmt.Sprintf("%v revision %v", revision, value)
+	}
+	if hash, ok := rs.Labels[appsv1.DefaultDeploymentUniqueLabelKey]; ok {
+		revision = fmt.Sprintf("%v hash %v", revision, hash)
+	}
+	return revision
+}
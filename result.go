@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// Result is the result of a check.
+type Result struct {
+	Status    string // "0" OK, "1" WARNING, "2" CRITICAL or "UNKNOWN"
+	ExitCode  int    // exit code of the exec command, -1 if it did not run
+	Stdout    string
+	Stderr    string
+	Duration  time.Duration
+	Pod       string
+	Container string
+	Namespace string
+	// Message describes the result, followed by performance data if any.
+	Message string
+	// Reason classifies why the check reached its status: "ok",
+	// "bad-exit-code", "output-mismatch", "status-word" when read from the
+	// output, "timeout", "not-found", "not-running", "auth", "connection",
+	// "config", "assertion" when a check of the pod or its spec failed
+	// without exec, or else "error".
+	Reason string
+	// Err is the cause of an UNKNOWN status when the check cannot be
+	// performed, to be inspected with errors.Is or errors.As. Message then
+	// is its text.
+	Err error
+	// Timings are the durations of the config, pod-get and exec phases,
+	// the exec one covering all the execs of an aggregated check.
+	Timings Timings
+
+	// results are the results of each pod or namespace of an aggregated
+	// check, which the textfile records instead of the aggregate.
+	results []Result
+}
+
+// errorResult returns the result of a check which cannot be performed.
+func errorResult(req *Request, err error) *Result {
+	result := &Result{Namespace: req.Namespace, ExitCode: -1, Status: "UNKNOWN"}
+	result.setOutput(err)
+	return result
+}
+
+// records returns the results to record for the check: the ones of each
+// pod or namespace it aggregates, else its own.
+func (r *Result) records() []Result {
+	if r.results != nil {
+		return r.results
+	}
+	return []Result{*r}
+}
+
+// setOutput sets the message of the result, and its error if output is one.
+// The status must be set first, so that the reason is set unless it already
+// was.
+func (r *Result) setOutput(output interface{}) {
+	r.Err, _ = output.(error)
+	r.Message = fmt.Sprint(output)
+	r.Reason = resultReason(r)
+}
+
+// reasonError sets the reason of the result of a check failed with the error.
+type reasonError struct {
+	reason string
+	error
+}
+
+func (e reasonError) Unwrap() error {
+	return e.error
+}
+
+func withReason(reason string, err error) error {
+	return reasonError{reason: reason, error: err}
+}
+
+// resultReason returns the reason of the result, the one already set unless
+// it is OK, else the one classifying its error.
+func resultReason(r *Result) string {
+	var tagged reasonError
+	switch {
+	case r.Status == "0":
+		return "ok"
+	case r.Reason != "" && r.Reason != "ok":
+		return r.Reason
+	case r.Err == nil && r.ExitCode >= 0:
+		return "bad-exit-code"
+	case r.Err == nil:
+		return "assertion"
+	case errors.As(r.Err, &tagged):
+		return tagged.reason
+	case errors.Is(r.Err, context.DeadlineExceeded):
+		return "timeout"
+	case isNotFound(r.Err):
+		return "not-found"
+	case apierrors.IsForbidden(r.Err) || apierrors.IsUnauthorized(r.Err) || strings.Contains(r.Err.Error(), "[auth]"):
+		return "auth"
+	case isConnectionFailure(r) || strings.Contains(r.Err.Error(), "[connection]"):
+		return "connection"
+	case strings.Contains(r.Err.Error(), "[config]"):
+		return "config"
+	default:
+		return "error"
+	}
+}
+
+// String formats the result as a Nagios plugin output.
+func (r Result) String() string {
+	return fmt.Sprintf("%v - %v", statusNames[r.Status], r.Message)
+}
+
+// statusValues are the Nagios exit codes of the statuses.
+var statusValues = map[string]int{
+	"0":       0,
+	"1":       1,
+	"2":       2,
+	"UNKNOWN": 3,
+}
+
+// ProcessExitCode returns the Nagios exit code of the result, for the plugin
+// process to exit with. It is not the exit code of the exec command.
+func (r Result) ProcessExitCode() int {
+	return statusValues[r.Status]
+}
+
+// apiErrorDetails holds the details of the metav1.Status returned by the API
+// server with an error, so that tooling can branch on its reason.
+type apiErrorDetails struct {
+	Reason  string `json:"reason"`
+	Code    int32  `json:"code"`
+	Message string `json:"message"`
+}
+
+type jsonResult struct {
+	Status    string           `json:"status"`
+	ExitCode  int              `json:"exitCode"`
+	Stdout    string           `json:"stdout,omitempty"`
+	Stderr    string           `json:"stderr,omitempty"`
+	StdoutB64 string           `json:"stdoutBase64,omitempty"`
+	StderrB64 string           `json:"stderrBase64,omitempty"`
+	Duration  float64          `json:"durationSeconds"`
+	Config    float64          `json:"configSeconds"`
+	PodGet    float64          `json:"podGetSeconds"`
+	Exec      float64          `json:"execSeconds"`
+	Pod       string           `json:"pod,omitempty"`
+	Container string           `json:"container,omitempty"`
+	Namespace string           `json:"namespace"`
+	Message   string           `json:"message"`
+	Reason    string           `json:"reason"`
+	APIError  *apiErrorDetails `json:"apiError,omitempty"`
+}
+
+// MarshalJSON formats the result as JSON, with the duration of each phase.
+// When the check failed with an API error, its status details are included.
+// A binary stdout or stderr is base64 encoded, since JSON strings can't hold
+// it.
+func (r Result) MarshalJSON() ([]byte, error) {
+	result := jsonResult{
+		Status:    statusNames[r.Status],
+		ExitCode:  r.ExitCode,
+		Stdout:    r.Stdout,
+		Stderr:    r.Stderr,
+		Duration:  r.Duration.Seconds(),
+		Config:    r.Timings.Config.Seconds(),
+		PodGet:    r.Timings.PodGet.Seconds(),
+		Exec:      r.Timings.Exec.Seconds(),
+		Pod:       r.Pod,
+		Container: r.Container,
+		Namespace: r.Namespace,
+		Message:   r.Message,
+		Reason:    r.Reason,
+	}
+	if isBinaryOutput(r.Stdout) {
+		result.Stdout, result.StdoutB64 = "", base64.StdEncoding.EncodeToString([]byte(r.Stdout))
+	}
+	if isBinaryOutput(r.Stderr) {
+		result.Stderr, result.StderrB64 = "", base64.StdEncoding.EncodeToString([]byte(r.Stderr))
+	}
+	var apiStatus apierrors.APIStatus
+	if r.Err != nil && errors.As(r.Err, &apiStatus) {
+		s := apiStatus.Status()
+		result.APIError = &apiErrorDetails{
+			Reason:  string(s.Reason),
+			Code:    s.Code,
+			Message: s.Message,
+		}
+	}
+	return json.Marshal(result)
+}
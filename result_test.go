@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestOutputFormats(t *testing.T) {
+	result := &Result{Status: "1", ExitCode: 3, Namespace: "test", Message: "Exit Code: 3 | exec_time=0.100s\nlong output", Reason: "bad-exit-code"}
+	tests := map[string]string{
+		"text":    "WARNING - Exit Code: 3 | exec_time=0.100s\nlong output",
+		"icinga2": "WARNING - Exit Code: 3 | 'exec_time'=0.100s\nlong output",
+	}
+	for format, want := range tests {
+		output, err := outputFormats[format](result)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if output != want {
+			t.Errorf("%v output %q instead of %q", format, output, want)
+		}
+	}
+}
+
+func TestMarshalJSON(t *testing.T) {
+	result := Result{
+		Status:   "1",
+		ExitCode: 3,
+		Stdout:   "\x00\xff",
+		Reason:   "bad-exit-code",
+		Timings:  Timings{Config: time.Second, PodGet: 2 * time.Second, Exec: 3 * time.Second},
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parsed map[string]interface{}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		t.Fatalf("invalid json output %s: %v", data, err)
+	}
+	want := map[string]interface{}{
+		"status":        "WARNING",
+		"reason":        "bad-exit-code",
+		"stdoutBase64":  "AP8=",
+		"configSeconds": 1.0,
+		"podGetSeconds": 2.0,
+		"execSeconds":   3.0,
+	}
+	for key, value := range want {
+		if parsed[key] != value {
+			t.Errorf("json %v is %v instead of %v", key, parsed[key], value)
+		}
+	}
+	if _, ok := parsed["stdout"]; ok {
+		t.Errorf("binary stdout not base64 encoded: %s", data)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+)
+
+// resultRecord is a line of the result file, the JSON result of a check run
+// with its time, to build a history of the check.
+type resultRecord struct {
+	Time   time.Time `json:"time"`
+	Result *Result   `json:"result"`
+}
+
+// appendResultFile appends the result to the result file, as a JSON line. The
+// file is locked during the write, so that the lines of concurrent checks
+// don't interleave. Failures are only logged, they don't change the check
+// result.
+func appendResultFile(req *Request, result *Result) {
+	line, err := json.Marshal(resultRecord{Time: time.Now(), Result: result})
+	if err != nil {
+		log.Printf("Failed to write result file: %v", err)
+		return
+	}
+
+	unlock, err := lockFile(req.resultFile + ".lock")
+	if err != nil {
+		log.Printf("Failed to write result file: %v", err)
+		return
+	}
+	defer unlock()
+
+	file, err := os.OpenFile(req.resultFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err == nil {
+		_, err = file.Write(append(line, '\n'))
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		log.Printf("Failed to write result file: %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path"
+
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// runFailedExitCode is the exit code of the run subcommand when the command
+// could not be run, as ssh does.
+const runFailedExitCode = 255
+
+// runCommand runs the command in the container of the pod selected as the
+// check does, relaying its stdout and stderr, and the plugin stdin if
+// requested, and returns its exit code.
+func runCommand(ctx context.Context, req *Request, command []string, stdin bool) (int, error) {
+	if err := resolveNamespace(req); err != nil {
+		return 0, fmt.Errorf("[config] %w", err)
+	}
+	if req.allowedCommandsFile != "" {
+		allowReq := *req
+		allowReq.Command, allowReq.Arg, allowReq.PreExec = command[0], "", ""
+		if shells[path.Base(command[0])] && len(command) == 3 && command[1] == "-c" {
+			allowReq.Arg = command[2]
+		}
+		if err := checkAllowedCommand(&allowReq); err != nil {
+			return 0, err
+		}
+	}
+
+	config, kubeClient, err := req.connect()
+	if err != nil {
+		return 0, err
+	}
+	if req.Deployment != "" {
+		if _, err := resolveDeployment(ctx, kubeClient, req); err != nil {
+			return 0, err
+		}
+	}
+	if req.ReplicaSet != "" {
+		if _, err := resolveReplicaSet(ctx, kubeClient, req); err != nil {
+			return 0, err
+		}
+	}
+	pods, err := getPods(ctx, kubeClient, req)
+	if err != nil {
+		return 0, err
+	}
+	container := getContainer(pods[0], req.Container)
+	if container == nil {
+		return 0, fmt.Errorf(`Container "%v" not found`, req.Container)
+	}
+
+	exec, err := newExecutor(config, kubeClient, req, pods[0].Name, container.Name, command, stdin)
+	if err != nil {
+		return 0, err
+	}
+	options := remotecommand.StreamOptions{Stdout: os.Stdout, Stderr: os.Stderr}
+	if stdin {
+		options.Stdin = os.Stdin
+	}
+	release, err := acquireStream(ctx, req, config.Host)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+	return execExitCode(ctx, exec.StreamWithContext(ctx, options))
+}
+
+// newRunCmd returns the run subcommand, which shares the flags of the check
+// command to select the pod and the container.
+func newRunCmd(check *cobra.Command, req *Request) *cobra.Command {
+	var stdin bool
+	c := &cobra.Command{
+		Use:   "run [flags] -- COMMAND [ARG...]",
+		Short: "Run a command in the container, relaying its output and exit code, as kubectl exec does",
+		Args:  cobra.MinimumNArgs(1),
+
+		PreRunE: check.PreRunE,
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx, cancel := runContext(req)
+			exitCode, err := runCommand(ctx, req, args, stdin)
+			cancel()
+			if err != nil {
+				log.Print(err)
+				os.Exit(runFailedExitCode)
+			}
+			os.Exit(exitCode)
+		},
+	}
+
+	c.Flags().AddFlagSet(check.Flags())
+	c.Flags().BoolVarP(&stdin, "stdin", "i", false, "Pass the plugin stdin to the command")
+	return c
+}
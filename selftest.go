@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// selfTest is a check of the code paths which don't need a cluster against
+// synthetic inputs, to sanity check a build where the API server can't be
+// reached.
+type selfTest struct {
+	name string
+	run  func() error
+}
+
+// selfTests returns the self tests, built on demand as the flags test
+// creates the command which runs them.
+func selfTests() []selfTest {
+	return []selfTest{
+		{"flags", func() error {
+			c := NewCmd()
+			if err := c.ParseFlags([]string{"--namespace", "selftest", "--ok-codes", "0,3", "--expect-output", "^ok$", "--timeout", "5s"}); err != nil {
+				return err
+			}
+			okCodes, _ := c.Flags().GetIntSlice("ok-codes")
+			timeout, _ := c.Flags().GetDuration("timeout")
+			if !reflect.DeepEqual(okCodes, []int{0, 3}) || timeout.Seconds() != 5 {
+				return fmt.Errorf("parsed --ok-codes %v and --timeout %v", okCodes, timeout)
+			}
+			return nil
+		}},
+		{"command-vector", func() error {
+			req := &Request{Command: "/bin/sh"}
+			setCommandArgs(req, []string{"sh", "-c", "echo ok"})
+			command, stdinLines, err := execCommandLine(req)
+			if err != nil {
+				return err
+			}
+			if !reflect.DeepEqual(command, []string{"sh", "-c", "echo ok"}) || len(stdinLines) > 0 || req.Arg != "echo ok" {
+				return fmt.Errorf("got command %q, stdin %q and script %q", command, stdinLines, req.Arg)
+			}
+			req = &Request{Command: "/bin/sh", Arg: "echo ok", Workdir: "/tmp"}
+			if command := shellCommand(req); !reflect.DeepEqual(command, []string{"/bin/sh", "-c", "cd '/tmp' && echo ok"}) {
+				return fmt.Errorf("got working directory command %q", command)
+			}
+			return nil
+		}},
+		{"output-matching", func() error {
+			req := &Request{OkCodes: []int{0}, ExpectOutput: []string{"^ready$"}, NormalizeOutput: []string{"trim", "lowercase"}}
+			for _, c := range []struct {
+				exitCode int
+				stdout   string
+				status   string
+			}{
+				{0, " Ready\n", "0"},
+				{0, "starting\n", "2"},
+				{1, "ready\n", "2"},
+			} {
+				status, _, message, err := evaluateExec(req, c.exitCode, c.stdout, "")
+				if err != nil {
+					return err
+				}
+				if status != c.status {
+					return fmt.Errorf("exit code %v and stdout %q gave %v instead of %v: %v", c.exitCode, c.stdout, statusNames[status], statusNames[c.status], message)
+				}
+			}
+			return nil
+		}},
+		{"status-mapping", func() error {
+			ranges := []statusRange{{min: 0, max: 0, status: "0"}, {min: 3, max: 3, status: "1"}, {min: 10, max: 20, status: "UNKNOWN"}}
+			for exitCode, status := range map[int]string{0: "0", 3: "1", 15: "UNKNOWN", 1: "2"} {
+				if mapped := mapExitCode(ranges, exitCode); mapped != status {
+					return fmt.Errorf("exit code %v mapped to %v instead of %v", exitCode, statusNames[mapped], statusNames[status])
+				}
+			}
+			return nil
+		}},
+		{"formatters", func() error {
+			result := &Result{Status: "1", ExitCode: 3, Namespace: "selftest", Message: "Exit Code: 3 | exec_time=0.100s\nlong output", Reason: "bad-exit-code"}
+			expected := map[string]string{
+				"text":    "WARNING - Exit Code: 3 | exec_time=0.100s\nlong output",
+				"icinga2": "WARNING - Exit Code: 3 | 'exec_time'=0.100s\nlong output",
+			}
+			for format, want := range expected {
+				output, err := outputFormats[format](result)
+				if err != nil {
+					return err
+				}
+				if output != want {
+					return fmt.Errorf("%v output %q instead of %q", format, output, want)
+				}
+			}
+			output, err := outputFormats["json"](result)
+			if err != nil {
+				return err
+			}
+			var parsed map[string]interface{}
+			if err := json.Unmarshal([]byte(output), &parsed); err != nil {
+				return fmt.Errorf("invalid json output %q: %w", output, err)
+			}
+			if parsed["status"] != "WARNING" || parsed["reason"] != "bad-exit-code" {
+				return fmt.Errorf("json output %q", output)
+			}
+			return nil
+		}},
+		{"binary-output", func() error {
+			if output := commandOutput(&Request{}, "\x00\xff", ""); !strings.Contains(output, "<binary output, 2 bytes>") {
+				return fmt.Errorf("binary output shown as %q", output)
+			}
+			return nil
+		}},
+	}
+}
+
+// runSelfTests runs the self tests, one step of the report each.
+func runSelfTests() []validationStep {
+	tests := selfTests()
+	steps := make([]validationStep, 0, len(tests))
+	for _, test := range tests {
+		if err := test.run(); err != nil {
+			steps = append(steps, validationStep{Name: test.name, Status: "FAIL", Message: err.Error()})
+			continue
+		}
+		steps = append(steps, validationStep{Name: test.name, Status: "PASS", Message: "ok"})
+	}
+	return steps
+}
+
+// newSelfTestCmd returns the selftest subcommand, which runs without a
+// cluster.
+func newSelfTestCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "selftest",
+		Short: "Check the flag parsing, command construction, output matching, status mapping and output formats of this build, without a cluster",
+
+		Run: func(cmd *cobra.Command, args []string) {
+			failed := false
+			for _, step := range runSelfTests() {
+				fmt.Println(step)
+				failed = failed || step.Status != "PASS"
+			}
+			if failed {
+				os.Exit(1)
+			}
+		},
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// sidecarPollInterval is the interval between two polls of the sidecar
+// readiness.
+const sidecarPollInterval = time.Second
+
+// sidecarStatus returns the status of the sidecar, a regular container as
+// injected by Istio or Linkerd, or a native sidecar, i.e. an init container
+// always restarted, and whether the pod has it.
+func sidecarStatus(pod *corev1.Pod, name string) (*corev1.ContainerStatus, bool) {
+	if getContainer(pod, name) == nil && getInitContainer(pod, name) == nil {
+		return nil, false
+	}
+	if status := findContainerStatus(pod.Status.ContainerStatuses, name); status != nil {
+		return status, true
+	}
+	return findContainerStatus(pod.Status.InitContainerStatuses, name), true
+}
+
+func getInitContainer(pod *corev1.Pod, name string) *corev1.Container {
+	for i := range pod.Spec.InitContainers {
+		if pod.Spec.InitContainers[i].Name == name {
+			return &pod.Spec.InitContainers[i]
+		}
+	}
+	return nil
+}
+
+// waitSidecar polls the pod until the sidecar is ready, so that the command
+// does not fail to connect through a mesh proxy which is still starting. It
+// fails after the sidecar timeout, or once ctx is done.
+func waitSidecar(ctx context.Context, kubeClient *kubernetes.Clientset, req *Request, pod *corev1.Pod) error {
+	ctx, cancel := context.WithTimeout(ctx, req.WaitSidecarTimeout)
+	defer cancel()
+	name := pod.Name
+	start := time.Now()
+	for {
+		status, ok := sidecarStatus(pod, req.WaitSidecar)
+		if !ok {
+			return withReason("not-found", fmt.Errorf(`Sidecar "%v" not found in pod "%v"`, req.WaitSidecar, name))
+		}
+		if status != nil && status.Ready {
+			if waited := time.Since(start); waited >= sidecarPollInterval {
+				log.Printf(`Sidecar "%v" ready after %v`, req.WaitSidecar, waited.Round(time.Second))
+			}
+			return nil
+		}
+
+		waitDelay(ctx, sidecarPollInterval)
+		if ctx.Err() != nil {
+			return withReason("timeout", fmt.Errorf(`Sidecar "%v" not ready after %v: %w`, req.WaitSidecar, time.Since(start).Round(time.Second), ctx.Err()))
+		}
+		var err error
+		if pod, err = kubeClient.CoreV1().Pods(req.Namespace).Get(ctx, name, metav1.GetOptions{}); err != nil {
+			return fmt.Errorf(`Failed to get pod "%v": %w`, name, err)
+		}
+	}
+}
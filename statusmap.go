@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// statusRange maps the exit codes from min to max, included, to a status.
+type statusRange struct {
+	min, max int
+	status   string
+}
+
+// readStatusMap reads the YAML or JSON file mapping exit codes, or ranges of
+// exit codes, to statuses, e.g. {0: OK, 3: WARNING, "10-20": CRITICAL}.
+func readStatusMap(path string) ([]statusRange, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read status map file: %w", err)
+	}
+	var statusMap map[string]string
+	if err := yaml.Unmarshal(data, &statusMap); err != nil {
+		return nil, fmt.Errorf("Invalid status map file: %w", err)
+	}
+
+	var ranges []statusRange
+	for codes, name := range statusMap {
+		status, ok := outputStatuses[strings.ToUpper(name)]
+		if !ok {
+			return nil, fmt.Errorf(`Invalid status "%v" of exit codes "%v" [Values: OK, WARNING, CRITICAL, UNKNOWN]`, name, codes)
+		}
+		r := statusRange{status: status}
+		bounds := strings.SplitN(codes, "-", 2)
+		if r.min, err = strconv.Atoi(strings.TrimSpace(bounds[0])); err == nil {
+			r.max = r.min
+			if len(bounds) == 2 {
+				r.max, err = strconv.Atoi(strings.TrimSpace(bounds[1]))
+			}
+		}
+		if err != nil || r.min < 0 || r.max < r.min {
+			return nil, fmt.Errorf(`Invalid exit codes "%v" [Format: 'code' or 'min-max']`, codes)
+		}
+		ranges = append(ranges, r)
+	}
+
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].min < ranges[j].min })
+	for i := 1; i < len(ranges); i++ {
+		if ranges[i].min <= ranges[i-1].max {
+			return nil, fmt.Errorf("Overlapping exit codes %v-%v and %v-%v in status map",
+				ranges[i-1].min, ranges[i-1].max, ranges[i].min, ranges[i].max)
+		}
+	}
+	return ranges, nil
+}
+
+// mapExitCode returns the status the exit code is mapped to, CRITICAL if it
+// is not in the map.
+func mapExitCode(ranges []statusRange, exitCode int) string {
+	for _, r := range ranges {
+		if exitCode >= r.min && exitCode <= r.max {
+			return r.status
+		}
+	}
+	return "2"
+}
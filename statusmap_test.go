@@ -0,0 +1,49 @@
+package main
+
+import "testing"
+
+func TestReadStatusMap(t *testing.T) {
+	path := writeTestFile(t, "status-map.yaml", `{0: OK, 3: warning, "10-20": UNKNOWN}`)
+	ranges, err := readStatusMap(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for exitCode, status := range map[int]string{0: "0", 3: "1", 10: "UNKNOWN", 15: "UNKNOWN", 20: "UNKNOWN", 1: "2", 21: "2"} {
+		if mapped := mapExitCode(ranges, exitCode); mapped != status {
+			t.Errorf("exit code %v mapped to %v instead of %v", exitCode, statusNames[mapped], statusNames[status])
+		}
+	}
+}
+
+func TestReadStatusMapInvalid(t *testing.T) {
+	tests := map[string]string{
+		"unknown status":  `{0: FINE}`,
+		"invalid code":    `{zero: OK}`,
+		"reversed range":  `{"20-10": OK}`,
+		"negative code":   `{"-1": OK}`,
+		"overlap":         `{"0-5": OK, 3: WARNING}`,
+		"not a map":       `[OK]`,
+		"missing bound":   `{"3-": OK}`,
+		"overlap at edge": `{"0-3": OK, "3-4": CRITICAL}`,
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := readStatusMap(writeTestFile(t, "status-map.yaml", content)); err == nil {
+				t.Errorf("status map %v accepted", content)
+			}
+		})
+	}
+}
+
+func TestEvaluateExecStatusMap(t *testing.T) {
+	req := &Request{StatusMapFile: writeTestFile(t, "status-map.yaml", `{0: OK, 1: WARNING}`)}
+	for exitCode, status := range map[int]string{0: "0", 1: "1", 2: "2"} {
+		got, _, message, err := evaluateExec(req, exitCode, "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != status {
+			t.Errorf("exit code %v gave %v instead of %v: %v", exitCode, statusNames[got], statusNames[status], message)
+		}
+	}
+}
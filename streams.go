@@ -0,0 +1,69 @@
+package main
+
+// The exec streams opened against the same API server may be capped, across
+// the checks running concurrently on the host, since the API server and the
+// kubelets limit the exec connections they serve: past these limits, checks
+// fail together instead of waiting. Each stream holds one of the slots, a lock
+// file, for its duration, so that the cap spans the invocations scheduled by
+// the monitoring system.
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+)
+
+// streamSlotPollInterval is the interval between two attempts to take a
+// stream slot while all of them are held.
+const streamSlotPollInterval = 100 * time.Millisecond
+
+// tryLockFile takes an exclusive lock on the file if no one holds it.
+func tryLockFile(path string) (func(), bool, error) {
+	lock, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		lock.Close()
+		if err == syscall.EWOULDBLOCK {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return func() {
+		syscall.Flock(int(lock.Fd()), syscall.LOCK_UN)
+		lock.Close()
+	}, true, nil
+}
+
+// acquireStream waits for one of the stream slots of the API server to be
+// free and takes it until the returned function is called. Without a cap, it
+// returns at once.
+func acquireStream(ctx context.Context, req *Request, host string) (func(), error) {
+	if req.maxStreams <= 0 {
+		return func() {}, nil
+	}
+	key := fmt.Sprintf("%x", sha256.Sum256([]byte(host)))
+	for {
+		for i := 0; i < req.maxStreams; i++ {
+			path, err := statePath(fmt.Sprintf("streams-%v-%v.lock", key, i))
+			if err != nil {
+				return nil, fmt.Errorf("Failed to take an exec stream slot: %w", err)
+			}
+			release, ok, err := tryLockFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to take an exec stream slot: %w", err)
+			}
+			if ok {
+				return release, nil
+			}
+		}
+		waitDelay(ctx, streamSlotPollInterval)
+		if ctx.Err() != nil {
+			return nil, withReason("timeout", fmt.Errorf("All %v exec streams to %v busy: %w", req.maxStreams, host, ctx.Err()))
+		}
+	}
+}
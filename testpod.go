@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// testPodPollInterval is the interval between two polls of the test pod
+// phase.
+const testPodPollInterval = time.Second
+
+// testPodLabel and testPodManager label the test pods, so that teardown only
+// deletes a pod created by setup.
+const (
+	testPodLabel   = "app.kubernetes.io/managed-by"
+	testPodManager = "checkexec"
+)
+
+// testPod returns the manifest of the test pod, which runs an idle shell
+// container as "kubectl run --generator=run-pod/v1 shell --image ubuntu" did.
+func testPod(req *Request, image string) *corev1.Pod {
+	var grace int64
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      req.Pod,
+			Namespace: req.Namespace,
+			Labels:    map[string]string{testPodLabel: testPodManager},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name:    "shell",
+				Image:   image,
+				Command: []string{"tail", "-f", "/dev/null"},
+			}},
+			RestartPolicy:                 corev1.RestartPolicyNever,
+			TerminationGracePeriodSeconds: &grace,
+		},
+	}
+}
+
+// setupTestPod creates the test pod and waits for it to be running.
+func setupTestPod(ctx context.Context, req *Request, image string) error {
+	if err := resolveNamespace(req); err != nil {
+		return fmt.Errorf("[config] %w", err)
+	}
+	_, kubeClient, err := req.connect()
+	if err != nil {
+		return err
+	}
+
+	if _, err := kubeClient.CoreV1().Pods(req.Namespace).Create(ctx, testPod(req, image), metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf(`Failed to create pod "%v" in namespace "%v": %w`, req.Pod, req.Namespace, err)
+	}
+	log.Printf(`Created pod "%v" in namespace "%v", waiting for it to be running`, req.Pod, req.Namespace)
+
+	for {
+		pod, err := kubeClient.CoreV1().Pods(req.Namespace).Get(ctx, req.Pod, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf(`Failed to get pod "%v": %w`, req.Pod, err)
+		}
+		switch pod.Status.Phase {
+		case corev1.PodRunning:
+			return nil
+		case corev1.PodFailed, corev1.PodSucceeded:
+			return fmt.Errorf(`Pod "%v" is %v instead of running`, req.Pod, pod.Status.Phase)
+		}
+		waitDelay(ctx, testPodPollInterval)
+		if ctx.Err() != nil {
+			return withReason("timeout", fmt.Errorf(`Pod "%v" is still %v: %w`, req.Pod, pod.Status.Phase, ctx.Err()))
+		}
+	}
+}
+
+// teardownTestPod deletes the test pod, doing nothing if it does not exist.
+// It refuses to delete a pod which setup did not create, and deletes the pod
+// it checked rather than one created with the same name in the meantime.
+func teardownTestPod(ctx context.Context, req *Request) error {
+	if err := resolveNamespace(req); err != nil {
+		return fmt.Errorf("[config] %w", err)
+	}
+	_, kubeClient, err := req.connect()
+	if err != nil {
+		return err
+	}
+
+	pods := kubeClient.CoreV1().Pods(req.Namespace)
+	pod, err := pods.Get(ctx, req.Pod, metav1.GetOptions{})
+	if err == nil {
+		if pod.Labels[testPodLabel] != testPodManager {
+			return fmt.Errorf(`Pod "%v" in namespace "%v" was not created by setup-test-pod, missing label %v=%v`, req.Pod, req.Namespace, testPodLabel, testPodManager)
+		}
+		uid := pod.UID
+		err = pods.Delete(ctx, req.Pod, metav1.DeleteOptions{Preconditions: &metav1.Preconditions{UID: &uid}})
+	}
+	if apierrors.IsNotFound(err) {
+		log.Printf(`Pod "%v" not found in namespace "%v"`, req.Pod, req.Namespace)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf(`Failed to delete pod "%v" in namespace "%v": %w`, req.Pod, req.Namespace, err)
+	}
+	log.Printf(`Deleted pod "%v" in namespace "%v"`, req.Pod, req.Namespace)
+	return nil
+}
+
+// testPodContext returns the context of a test pod subcommand, bounded by the
+// wait timeout unless the check timeout or deadline is earlier.
+func testPodContext(req *Request, wait time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := runContext(req)
+	if wait <= 0 {
+		return ctx, cancel
+	}
+	ctx, cancelWait := context.WithTimeout(ctx, wait)
+	return ctx, func() {
+		cancelWait()
+		cancel()
+	}
+}
+
+// newSetupTestPodCmd returns the setup-test-pod subcommand, which creates a
+// pod to try the check against, named and placed by the --pod and
+// --namespace flags of the check command.
+func newSetupTestPodCmd(check *cobra.Command, req *Request) *cobra.Command {
+	var image string
+	var wait time.Duration
+	c := &cobra.Command{
+		Use:   "setup-test-pod",
+		Short: "Create an idle test pod with a \"shell\" container to try the check against, and wait for it to be running",
+
+		PreRunE: check.PreRunE,
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx, cancel := testPodContext(req, wait)
+			err := setupTestPod(ctx, req, image)
+			cancel()
+			if err != nil {
+				log.Fatalf("%v", err)
+			}
+			fmt.Printf("Pod \"%v\" is running in namespace \"%v\", try: checkexec --namespace %v --pod %v --container shell --cmd true\n", req.Pod, req.Namespace, req.Namespace, req.Pod)
+		},
+	}
+
+	c.Flags().AddFlagSet(check.Flags())
+	c.Flags().StringVar(&image, "image", "ubuntu", "Image of the test pod, which must provide tail, such as ubuntu or busybox")
+	c.Flags().DurationVar(&wait, "wait-timeout", 2*time.Minute, "Fail if the test pod is not running within this duration")
+	return c
+}
+
+// newTeardownTestPodCmd returns the teardown-test-pod subcommand, which
+// deletes the pod created by setup-test-pod.
+func newTeardownTestPodCmd(check *cobra.Command, req *Request) *cobra.Command {
+	c := &cobra.Command{
+		Use:   "teardown-test-pod",
+		Short: "Delete the test pod created by setup-test-pod",
+
+		PreRunE: check.PreRunE,
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx, cancel := runContext(req)
+			err := teardownTestPod(ctx, req)
+			cancel()
+			if err != nil {
+				log.Fatalf("%v", err)
+			}
+		},
+	}
+
+	c.Flags().AddFlagSet(check.Flags())
+	return c
+}
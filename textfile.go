@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// writeTextfile writes the results as Prometheus metrics in the text
+// exposition format, for the node_exporter textfile collector. The file is
+// replaced atomically so that the collector never reads a partial file.
+// Failures are only logged, they don't change the check result. With the
+// circuit breaker, its state is written too.
+func writeTextfile(req *Request, results []Result) {
+	var buf bytes.Buffer
+	metrics := []struct {
+		name, help string
+		value      func(r Result) string
+	}{
+		{"checkexec_status", "Check status: 0 OK, 1 WARNING, 2 CRITICAL, 3 UNKNOWN.", func(r Result) string {
+			return fmt.Sprint(r.ProcessExitCode())
+		}},
+		{"checkexec_exit_code", "Exit code of the exec command, -1 if it did not run.", func(r Result) string {
+			return fmt.Sprint(r.ExitCode)
+		}},
+		{"checkexec_duration_seconds", "Duration of the check.", func(r Result) string {
+			return fmt.Sprintf("%.3f", r.Duration.Seconds())
+		}},
+	}
+	for _, metric := range metrics {
+		fmt.Fprintf(&buf, "# HELP %v %v\n# TYPE %v gauge\n", metric.name, metric.help, metric.name)
+		for _, r := range results {
+			fmt.Fprintf(&buf, "%v{namespace=\"%v\",pod=\"%v\",container=\"%v\",reason=\"%v\"} %v\n", metric.name,
+				labelValueEscaper.Replace(r.Namespace), labelValueEscaper.Replace(r.Pod),
+				labelValueEscaper.Replace(r.Container), r.Reason, metric.value(r))
+		}
+	}
+
+	if req.breakerThreshold > 0 {
+		writeBreakerMetrics(&buf, req)
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(req.textfileOutput), "."+filepath.Base(req.textfileOutput))
+	if err != nil {
+		log.Printf("Failed to write textfile output: %v", err)
+		return
+	}
+	_, err = tmp.Write(buf.Bytes())
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		// node_exporter requires the file to be readable by its own user
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), req.textfileOutput)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		log.Printf("Failed to write textfile output: %v", err)
+	}
+}
+
+// writeBreakerMetrics writes the state of the circuit breaker of the API
+// server, which is not the one of a pod.
+func writeBreakerMetrics(buf *bytes.Buffer, req *Request) {
+	state, err := readBreaker(req)
+	if err != nil {
+		log.Printf("Failed to read circuit breaker: %v", err)
+		return
+	}
+	open := 0
+	if state.isOpen(req) {
+		open = 1
+	}
+	fmt.Fprintf(buf, "# HELP checkexec_breaker_open Whether the circuit breaker is open, the checks failing fast.\n# TYPE checkexec_breaker_open gauge\ncheckexec_breaker_open %v\n", open)
+	fmt.Fprintf(buf, "# HELP checkexec_breaker_failures Consecutive connection failures to the API server.\n# TYPE checkexec_breaker_failures gauge\ncheckexec_breaker_failures %v\n", state.Failures)
+	fmt.Fprintf(buf, "# HELP checkexec_breaker_cooldown_seconds Duration the circuit breaker stays open for after its last trip.\n# TYPE checkexec_breaker_cooldown_seconds gauge\ncheckexec_breaker_cooldown_seconds %v\n",
+		state.cooldown(req.breakerCooldown, req.breakerMaxCooldown).Seconds())
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// throughputWindow is the sliding window over which the peak output rate is
+// measured.
+const throughputWindow = time.Second
+
+type outputChunk struct {
+	time  time.Time
+	bytes int
+}
+
+// outputRate measures the throughput of the output stream of the exec
+// command from the chunks written to its Writer.
+type outputRate struct {
+	start, end time.Time
+	bytes      int
+	window     []outputChunk
+	windowSize int
+	peak       int
+}
+
+func newOutputRate() *outputRate {
+	return &outputRate{start: time.Now()}
+}
+
+// add records a chunk of output received at t.
+func (r *outputRate) add(n int, t time.Time) {
+	r.bytes += n
+	r.window = append(r.window, outputChunk{time: t, bytes: n})
+	r.windowSize += n
+	for len(r.window) > 0 && t.Sub(r.window[0].time) >= throughputWindow {
+		r.windowSize -= r.window[0].bytes
+		r.window = r.window[1:]
+	}
+	if r.windowSize > r.peak {
+		r.peak = r.windowSize
+	}
+}
+
+// stop marks the end of the output stream.
+func (r *outputRate) stop() {
+	r.end = time.Now()
+}
+
+// PerfData formats the average output rate, over the whole exec, and the
+// peak one, the most bytes received within one second, in bytes per second.
+func (r *outputRate) PerfData() string {
+	var average float64
+	if elapsed := r.end.Sub(r.start).Seconds(); elapsed > 0 {
+		average = float64(r.bytes) / elapsed
+	}
+	return fmt.Sprintf("output_bytes=%vB output_rate=%.0f output_peak_rate=%v", r.bytes, average, r.peak)
+}
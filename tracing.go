@@ -0,0 +1,125 @@
+package main
+
+// The phases of a check may be traced with OpenTelemetry, the spans being
+// exported to an OTLP/HTTP collector. The trace context is propagated to the
+// API server requests, so that a slow check can be followed into the API
+// server traces. Without --trace, the global tracer provider is a no-op one.
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/client-go/rest"
+)
+
+var tracer = otel.Tracer("github.com/fjammes/checkexec")
+
+// setupTracing installs a tracer provider exporting the spans to the OTLP
+// endpoint, or to the one set by the OTEL_EXPORTER_OTLP_ENDPOINT environment
+// variable if empty. The returned function flushes the pending spans.
+func setupTracing(endpoint string) (func(), error) {
+	var options []otlptracehttp.Option
+	if endpoint != "" {
+		u, err := url.Parse(endpoint)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, fmt.Errorf(`Invalid OTLP endpoint "%v" [Format: 'http://host:4318']`, endpoint)
+		}
+		options = append(options, otlptracehttp.WithEndpoint(u.Host))
+		if u.Scheme == "http" {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		if u.Path != "" && u.Path != "/" {
+			options = append(options, otlptracehttp.WithURLPath(u.Path))
+		}
+	}
+	exporter, err := otlptracehttp.New(context.Background(), options...)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create OTLP exporter: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName("checkexec"))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := provider.Shutdown(ctx); err != nil {
+			log.Printf("Failed to export traces: %v", err)
+		}
+	}, nil
+}
+
+// startTracing sets up tracing if requested, exiting on an invalid setup, and
+// returns the function flushing the spans.
+func startTracing(req *Request) func() {
+	if !req.trace {
+		return func() {}
+	}
+	shutdown, err := setupTracing(req.otlpEndpoint)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	return shutdown
+}
+
+// startSpan starts a span of a phase of the check.
+func startSpan(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// endSpan ends the span, marking it as failed if err is not nil.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// traceTransport propagates the trace context of the API requests.
+type traceTransport struct {
+	next http.RoundTripper
+}
+
+func (t traceTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	otel.GetTextMapPropagator().Inject(r.Context(), propagation.HeaderCarrier(r.Header))
+	return t.next.RoundTrip(r)
+}
+
+func addTracePropagation(config *rest.Config) {
+	config.Wrap(func(next http.RoundTripper) http.RoundTripper {
+		return traceTransport{next: next}
+	})
+}
+
+// traceCheck runs check in a span recording the checked pod and its status.
+func traceCheck(ctx context.Context, req *Request, check func(context.Context, *Request) *Result) *Result {
+	ctx, span := startSpan(ctx, "check")
+	result := check(ctx, req)
+	span.SetAttributes(
+		attribute.String("k8s.namespace.name", result.Namespace),
+		attribute.String("k8s.pod.name", result.Pod),
+		attribute.String("k8s.container.name", result.Container),
+		attribute.String("checkexec.status", statusNames[result.Status]),
+	)
+	endSpan(span, result.Err)
+	return result
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// validationStep is the outcome of a preflight check of the validate
+// subcommand.
+type validationStep struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+func (s validationStep) String() string {
+	return fmt.Sprintf("%-4v %v: %v", s.Status, s.Name, s.Message)
+}
+
+// validationWarning is the error of a preflight check which could not be
+// performed, but which the following steps don't depend on.
+type validationWarning struct {
+	error
+}
+
+// validateSetup runs the preflight checks in order, from loading the client
+// config to running "true" in the container. Once a step fails, the
+// following ones, which depend on it, are skipped. A step ending with a
+// warning does not skip them.
+func validateSetup(ctx context.Context, req *Request) []validationStep {
+	var config *rest.Config
+	var kubeClient *kubernetes.Clientset
+	var pod *corev1.Pod
+	var container string
+	steps := []struct {
+		name string
+		run  func() (string, error)
+	}{
+		{"config", func() (string, error) {
+			if err := resolveNamespace(req); err != nil {
+				return "", fmt.Errorf("[config] %w", err)
+			}
+			var err error
+			config, kubeClient, err = req.connect()
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf(`API server "%v", namespace "%v"`, config.Host, req.Namespace), nil
+		}},
+		{"api-server", func() (string, error) {
+			info, err := kubeClient.Discovery().ServerVersion()
+			if err != nil {
+				return "", fmt.Errorf("API server unreachable: %w", err)
+			}
+			return fmt.Sprintf("Kubernetes %v", info.GitVersion), nil
+		}},
+		{"namespace", func() (string, error) {
+			_, err := kubeClient.CoreV1().Namespaces().Get(ctx, req.Namespace, metav1.GetOptions{})
+			if apierrors.IsForbidden(err) {
+				// namespaces are cluster-scoped, which a check limited to the
+				// namespace of its pods is usually not allowed to get
+				return "", validationWarning{fmt.Errorf(`Namespace "%v" not verified, getting it is forbidden: %w`, req.Namespace, err)}
+			}
+			if err != nil {
+				return "", fmt.Errorf(`Failed to get namespace "%v": %w`, req.Namespace, err)
+			}
+			return fmt.Sprintf(`Namespace "%v" exists`, req.Namespace), nil
+		}},
+		{"pod", func() (string, error) {
+			if req.Deployment != "" {
+				if _, err := resolveDeployment(ctx, kubeClient, req); err != nil {
+					return "", err
+				}
+			}
+			if req.ReplicaSet != "" {
+				if _, err := resolveReplicaSet(ctx, kubeClient, req); err != nil {
+					return "", err
+				}
+			}
+			pods, err := getPods(ctx, kubeClient, req)
+			if err != nil {
+				return "", err
+			}
+			pod = pods[0]
+			c := getContainer(pod, req.Container)
+			if c == nil {
+				return "", fmt.Errorf(`Container "%v" not found, pod "%v" has containers: %v`, req.Container, pod.Name, containerNames(pod))
+			}
+			container = c.Name
+			return fmt.Sprintf(`Pod "%v", container "%v"`, pod.Name, container), nil
+		}},
+		{"exec-permission", func() (string, error) {
+			review, err := kubeClient.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, &authorizationv1.SelfSubjectAccessReview{
+				Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+					ResourceAttributes: &authorizationv1.ResourceAttributes{
+						Namespace:   req.Namespace,
+						Verb:        "create",
+						Resource:    "pods",
+						Subresource: "exec",
+						Name:        pod.Name,
+					},
+				},
+			}, metav1.CreateOptions{})
+			if err != nil {
+				return "", fmt.Errorf("Failed to review pods/exec permission: %w", err)
+			}
+			if !review.Status.Allowed {
+				return "", fmt.Errorf("[auth] Missing pods/exec permission: %v", review.Status.Reason)
+			}
+			return fmt.Sprintf(`pods/exec allowed in namespace "%v"`, req.Namespace), nil
+		}},
+		{"exec", func() (string, error) {
+			exitCode, _, stderr, err := execCommand(ctx, config, kubeClient, req, pod.Name, container, []string{"true"}, nil)
+			if err != nil {
+				return "", err
+			}
+			if exitCode != 0 {
+				return "", fmt.Errorf(`"true" exited with %v: %v`, exitCode, stderr)
+			}
+			return `"true" exited with 0`, nil
+		}},
+	}
+
+	results := make([]validationStep, 0, len(steps))
+	failed := false
+	for _, step := range steps {
+		if failed {
+			results = append(results, validationStep{Name: step.name, Status: "SKIP", Message: "a previous step failed"})
+			continue
+		}
+		message, err := step.run()
+		var warning validationWarning
+		if errors.As(err, &warning) {
+			results = append(results, validationStep{Name: step.name, Status: "WARN", Message: err.Error()})
+			continue
+		}
+		if err != nil {
+			failed = true
+			results = append(results, validationStep{Name: step.name, Status: "FAIL", Message: err.Error()})
+			continue
+		}
+		results = append(results, validationStep{Name: step.name, Status: "PASS", Message: message})
+	}
+	return results
+}
+
+// newValidateCmd returns the validate subcommand, which shares the flags of
+// the check command to select the pod and the container.
+func newValidateCmd(check *cobra.Command, req *Request) *cobra.Command {
+	c := &cobra.Command{
+		Use:   "validate",
+		Short: "Check the config, the connectivity, the target pod and the exec permission before scheduling the check",
+
+		PreRunE: check.PreRunE,
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx, cancel := runContext(req)
+			steps := validateSetup(ctx, req)
+			cancel()
+
+			if req.outputFormat == "json" {
+				data, err := json.Marshal(steps)
+				if err != nil {
+					log.Fatalf("Failed to format validation: %v", err)
+				}
+				fmt.Println(string(data))
+			} else {
+				for _, step := range steps {
+					fmt.Println(step)
+				}
+			}
+			for _, step := range steps {
+				if step.Status == "FAIL" {
+					os.Exit(1)
+				}
+			}
+		},
+	}
+
+	c.Flags().AddFlagSet(check.Flags())
+	return c
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// webhookTimeout bounds the webhook request, so that a slow endpoint does not
+// delay the check result.
+const webhookTimeout = 5 * time.Second
+
+// validateWebhook checks the webhook URL and filter, and the CloudEvents sink
+// URL.
+func validateWebhook(req *Request) error {
+	if req.webhookOn != "all" && req.webhookOn != "failures-only" {
+		return fmt.Errorf(`Unsupported webhook filter "%v"`, req.webhookOn)
+	}
+	if req.webhookURL != "" && !isHTTPURL(req.webhookURL) {
+		return fmt.Errorf(`Invalid webhook URL "%v"`, req.webhookURL)
+	}
+	if req.cloudEventsSink != "" && !isHTTPURL(req.cloudEventsSink) {
+		return fmt.Errorf(`Invalid CloudEvents sink URL "%v"`, req.cloudEventsSink)
+	}
+	return nil
+}
+
+func isHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && u.Host != "" && (u.Scheme == "http" || u.Scheme == "https")
+}
+
+// postWebhook posts the JSON result to the webhook URL, unless it is OK and
+// only failures are posted. It is best effort: a failure is only logged and
+// does not change the result.
+func postWebhook(req *Request, result *Result) {
+	if req.webhookURL == "" || (req.webhookOn == "failures-only" && result.Status == "0") {
+		return
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		log.Printf("Failed to format webhook result: %v", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, req.webhookURL, bytes.NewReader(data))
+	if err != nil {
+		log.Printf("Failed to create webhook request: %v", err)
+		return
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		log.Printf("Failed to post result to webhook: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("Webhook rejected the result: %v", resp.Status)
+	}
+}